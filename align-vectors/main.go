@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"../vecutil"
+)
+
+var source_file, target_file, dict_file, test_dict_file, output_file string
+var binaryf int = 0
+var refine int = 0
+var refine_words int = 15000
+var debug_mode int = 2
+var num_threads int = 12
+
+// Reads a bilingual dictionary, one source word and one target word per line, keeping the pairs whose
+// words are in both models
+func ReadDictionary(file string, src, tgt *vecutil.Model) [][2]int {
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: dictionary %s not found\n", file)
+		os.Exit(1)
+	}
+	defer f.Close()
+	var pairs [][2]int
+	var lines int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		st := strings.Fields(scanner.Text())
+		if len(st) == 0 {
+			continue
+		}
+		lines++
+		if len(st) != 2 {
+			fmt.Fprintf(os.Stderr, "ERROR: %s:%d: expected a source and a target word\n", file, lines)
+			os.Exit(1)
+		}
+		a, ok1 := src.Index[st[0]]
+		b, ok2 := tgt.Index[st[1]]
+		if ok1 && ok2 {
+			pairs = append(pairs, [2]int{a, b})
+		}
+	}
+	vecutil.FailOnError(scanner.Err(), "Cannot read dictionary")
+	if debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "%s: %d of %d pairs found in the models\n", file, len(pairs), lines)
+	}
+	return pairs
+}
+
+// Returns the source vectors mapped by W and normalized to unit length
+func Apply(src *vecutil.Model, W []float64) *vecutil.Model {
+	d := src.Size
+	out := &vecutil.Model{Words: src.Words, Size: d, Vocab: src.Vocab, Index: src.Index, M: make([]float64, len(src.M))}
+	vecutil.ParallelRange(src.Words, num_threads, func(id, lo, hi int) {
+		for b := lo; b < hi; b++ {
+			for j := 0; j < d; j++ {
+				var s float64 = 0
+				for i := 0; i < d; i++ {
+					s += src.M[b*d+i] * W[i*d+j]
+				}
+				out.M[b*d+j] = s
+			}
+		}
+	})
+	out.Normalize()
+	return out
+}
+
+// Returns the pairs of mutual nearest neighbours among the refine_words most frequent words of both models
+func MutualNeighbours(mapped, tgt *vecutil.Model) [][2]int {
+	ns := refine_words
+	if ns > mapped.Words {
+		ns = mapped.Words
+	}
+	nt := refine_words
+	if nt > tgt.Words {
+		nt = tgt.Words
+	}
+	qs := make([]int, ns)
+	for a := range qs {
+		qs[a] = a
+	}
+	qt := make([]int, nt)
+	for a := range qt {
+		qt[a] = a
+	}
+	fwd := vecutil.NearestNeighbours(mapped, qs, tgt, nt, 1, num_threads)
+	bwd := vecutil.NearestNeighbours(tgt, qt, mapped, ns, 1, num_threads)
+	var pairs [][2]int
+	for a := 0; a < ns; a++ {
+		b := fwd[a][0]
+		if b >= 0 && bwd[b][0] == a {
+			pairs = append(pairs, [2]int{a, b})
+		}
+	}
+	return pairs
+}
+
+// Reports the precision at 1, 5 and 10 of translating the source words of the test pairs by their nearest
+// target neighbours; a source word with several translations is correct if any of them is found
+func Evaluate(mapped, tgt *vecutil.Model, pairs [][2]int) {
+	gold := make(map[int]map[int]bool)
+	var queries []int
+	for _, p := range pairs {
+		if gold[p[0]] == nil {
+			gold[p[0]] = make(map[int]bool)
+			queries = append(queries, p[0])
+		}
+		gold[p[0]][p[1]] = true
+	}
+	if len(queries) == 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: no test pairs found in the models\n")
+		os.Exit(1)
+	}
+	nn := vecutil.NearestNeighbours(mapped, queries, tgt, tgt.Words, 10, num_threads)
+	var hits [3]int
+	for a, q := range queries {
+		for c, b := range nn[a] {
+			if b >= 0 && gold[q][b] {
+				for e, k := range []int{1, 5, 10} {
+					if c < k {
+						hits[e]++
+					}
+				}
+				break
+			}
+		}
+	}
+	n := float64(len(queries))
+	fmt.Printf("Test words: %d\n", len(queries))
+	fmt.Printf("P@1: %.2f%%  P@5: %.2f%%  P@10: %.2f%%\n", float64(hits[0])/n*100, float64(hits[1])/n*100, float64(hits[2])/n*100)
+}
+
+func main() {
+	args := os.Args
+	if len(args) == 1 {
+		fmt.Fprintf(os.Stderr, "ALIGN VECTORS tool\n\n")
+		fmt.Fprintf(os.Stderr, "Maps the vectors of a source model into the space of a target model\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "\t-source <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse the source word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-target <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse the target word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe vectors are in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-dict <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse the seed dictionary in <file>, one source word and its target translation per line\n")
+		fmt.Fprintf(os.Stderr, "\t-test-dict <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tReport the precision at 1, 5 and 10 of translating the source words of the dictionary in <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> to save the mapped source vectors, normalized to unit length\n")
+		fmt.Fprintf(os.Stderr, "\t-refine <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tNumber of refinements that add the mutual nearest neighbours to the dictionary and learn the\n")
+		fmt.Fprintf(os.Stderr, "\t\tmapping again; default is 0\n")
+		fmt.Fprintf(os.Stderr, "\t-refine-words <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSearch mutual nearest neighbours among the <int> most frequent words of each model; default is 15000\n")
+		fmt.Fprintf(os.Stderr, "\t-threads <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <int> threads (default 12)\n")
+		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = more info during the refinements)\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "./align-vectors -source de.bin -target en.bin -binary 1 -dict de-en.train.txt -test-dict de-en.test.txt -refine 5 -output de-mapped.bin\n\n")
+		os.Exit(0)
+	}
+	if i := vecutil.ArgPos("-source", args); i > 0 {
+		source_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-target", args); i > 0 {
+		target_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		binaryf = int(v)
+	}
+	if i := vecutil.ArgPos("-dict", args); i > 0 {
+		dict_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-test-dict", args); i > 0 {
+		test_dict_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-output", args); i > 0 {
+		output_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-refine", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		refine = int(v)
+	}
+	if i := vecutil.ArgPos("-refine-words", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		refine_words = int(v)
+	}
+	if i := vecutil.ArgPos("-threads", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		num_threads = int(v)
+		if num_threads < 1 {
+			num_threads = 1
+		}
+	}
+	if i := vecutil.ArgPos("-debug", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		debug_mode = int(v)
+	}
+	if source_file == "" || target_file == "" || dict_file == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: -source, -target and -dict are required\n")
+		os.Exit(1)
+	}
+	src := vecutil.ReadVectors(source_file, binaryf != 0, debug_mode > 0)
+	tgt := vecutil.ReadVectors(target_file, binaryf != 0, debug_mode > 0)
+	if src.Size != tgt.Size {
+		fmt.Fprintf(os.Stderr, "ERROR: the source vectors have %d dimensions and the target vectors %d\n", src.Size, tgt.Size)
+		os.Exit(1)
+	}
+	src.Normalize()
+	tgt.Normalize()
+	seed := ReadDictionary(dict_file, src, tgt)
+	if len(seed) == 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: no seed pairs found in the models\n")
+		os.Exit(1)
+	}
+	W := vecutil.Procrustes(src, tgt, seed)
+	mapped := Apply(src, W)
+	for it := 0; it < refine; it++ {
+		// The seed pairs are kept; the mutual nearest neighbours are added to them
+		pairs := append([][2]int(nil), seed...)
+		known := make(map[[2]int]bool)
+		for _, p := range seed {
+			known[p] = true
+		}
+		induced := MutualNeighbours(mapped, tgt)
+		for _, p := range induced {
+			if !known[p] {
+				pairs = append(pairs, p)
+			}
+		}
+		if debug_mode > 1 {
+			fmt.Fprintf(os.Stderr, "Refinement %d: %d mutual nearest neighbours, %d pairs\n", it+1, len(induced), len(pairs))
+		}
+		W = vecutil.Procrustes(src, tgt, pairs)
+		mapped = Apply(src, W)
+	}
+	if test_dict_file != "" {
+		Evaluate(mapped, tgt, ReadDictionary(test_dict_file, src, tgt))
+	}
+	if output_file != "" {
+		vecutil.SaveVectors(output_file, mapped.Vocab, mapped.M, mapped.Size, binaryf != 0)
+	}
+	os.Exit(0)
+}
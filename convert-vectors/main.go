@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"../vecutil"
+)
+
+var input_file, output_file, output_meta_file, read_vocab_file string
+var read_vocab_format string = "auto"
+var input_format string = "word2vec"
+var output_format string = "word2vec"
+var binaryf int = 0
+var output_binary int = 0
+var debug_mode int = 2
+var words, size int
+var vocab []string
+var counts []int
+var M []float64
+
+// Reads word vectors in the text or binary format written by word2vec, or in the header-less GloVe format
+func ReadVectors() {
+	if input_format != "glove" {
+		m := vecutil.ReadVectors(input_file, binaryf != 0, debug_mode > 0)
+		words, size, vocab, M = m.Words, m.Size, m.Vocab, m.M
+		return
+	}
+	f, err := os.Open(input_file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Input file not found\n")
+		os.Exit(-1)
+	}
+	defer f.Close()
+	ReadGloVe(bufio.NewReader(f))
+}
+
+// Reads GloVe text vectors; the dimension is taken from the first line
+func ReadGloVe(br *bufio.Reader) {
+	size = -1
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			vecutil.FailOnError(err, "Cannot read input file")
+		}
+		st := strings.Fields(line)
+		if len(st) == 0 {
+			continue
+		}
+		if size == -1 {
+			size = len(st) - 1
+		}
+		if len(st) != size+1 {
+			fmt.Fprintf(os.Stderr, "ERROR: line for word %s has %d values, expected %d\n", st[0], len(st)-1, size)
+			os.Exit(1)
+		}
+		vocab = append(vocab, st[0])
+		for a := 0; a < size; a++ {
+			v, err := strconv.ParseFloat(st[a+1], 64)
+			vecutil.FailOnError(err, "Cannot read input file")
+			M = append(M, v)
+		}
+	}
+	words = len(vocab)
+	if debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "words: %d\n", words)
+		fmt.Fprintf(os.Stderr, "size: %d\n", size)
+	}
+}
+
+// Exits with the position of a malformed vocabulary entry
+func VocabError(line int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "ERROR: %s:%d: %s\n", read_vocab_file, line, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Returns the format of the vocabulary file: read_vocab_format, or with auto the format given by the
+// extension of the file, .tsv or .json, and text otherwise
+func VocabFileFormat() string {
+	if read_vocab_format != "auto" {
+		return read_vocab_format
+	}
+	switch strings.ToLower(filepath.Ext(read_vocab_file)) {
+	case ".tsv":
+		return "tsv"
+	case ".json":
+		return "json"
+	}
+	return "text"
+}
+
+// Reads word counts from a vocabulary file written by word2vec -save-vocab in the text, tsv or json format
+func ReadCounts() {
+	data, err := os.ReadFile(read_vocab_file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Vocabulary file not found\n")
+		os.Exit(1)
+	}
+	cn := make(map[string]int)
+	seen := make(map[string]int)
+	// Records the count of word read at line, rejecting words listed twice
+	add := func(line int, word string, count int64) {
+		if prev, ok := seen[word]; ok {
+			VocabError(line, "word %q already listed at line %d", word, prev)
+		}
+		seen[word] = line
+		cn[word] = int(count)
+	}
+	format := VocabFileFormat()
+	if format == "json" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		// Counts the lines up to the decoder position from where the previous call stopped
+		var counted int64 = 0
+		current := 1
+		lineOf := func() int {
+			off := dec.InputOffset()
+			current += bytes.Count(data[counted:off], []byte("\n"))
+			counted = off
+			return current
+		}
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			VocabError(lineOf(), "expected a JSON array of {\"word\": ..., \"count\": ...} objects")
+		}
+		for dec.More() {
+			// Skip the white space before the entry so that its own line is reported
+			line := lineOf()
+			for off := dec.InputOffset(); off < int64(len(data)) && strings.ContainsRune(" \t\r\n,", rune(data[off])); off++ {
+				if data[off] == '\n' {
+					line++
+				}
+			}
+			var entry struct {
+				Word  *string `json:"word"`
+				Count *int64  `json:"count"`
+			}
+			if err := dec.Decode(&entry); err != nil {
+				VocabError(line, "%v", err)
+			}
+			if entry.Word == nil || entry.Count == nil || *entry.Count < 0 {
+				VocabError(line, "entry without word or valid count")
+			}
+			add(line, *entry.Word, *entry.Count)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		line := 0
+		columns := 0
+		for scanner.Scan() {
+			line++
+			var st []string
+			if format == "tsv" {
+				st = strings.Split(strings.TrimRight(scanner.Text(), "\r"), "\t")
+				if line == 1 {
+					if len(st) < 2 || st[0] != "word" || st[1] != "count" {
+						VocabError(line, "expected a header starting with word<TAB>count")
+					}
+					columns = len(st)
+					continue
+				}
+				if len(st) == 1 && st[0] == "" {
+					continue
+				}
+				if len(st) != columns {
+					VocabError(line, "%d columns, the header has %d", len(st), columns)
+				}
+			} else {
+				st = strings.Fields(scanner.Text())
+				if len(st) == 0 {
+					continue
+				}
+				if len(st) != 2 {
+					VocabError(line, "expected a word and its count, found %d fields", len(st))
+				}
+			}
+			v, err := strconv.ParseInt(st[1], 10, 64)
+			if err != nil || v < 0 {
+				VocabError(line, "invalid count %q", st[1])
+			}
+			add(line, st[0], v)
+		}
+		if err := scanner.Err(); err != nil {
+			VocabError(line+1, "%v", err)
+		}
+	}
+	counts = make([]int, words)
+	for b := 0; b < words; b++ {
+		counts[b] = cn[vocab[b]]
+	}
+}
+
+// Returns the companion file written next to the output by the tensorboard and npy formats
+func MetaFileName() string {
+	if output_meta_file != "" {
+		return output_meta_file
+	}
+	if output_format == "tensorboard" {
+		return strings.TrimSuffix(output_file, ".tsv") + ".metadata.tsv"
+	}
+	return strings.TrimSuffix(output_file, ".npy") + ".vocab"
+}
+
+// Creates file for writing and exits on failure
+func CreateOutput(file string) (*os.File, *bufio.Writer) {
+	f, err := os.Create(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", file)
+		os.Exit(1)
+	}
+	return f, bufio.NewWriter(f)
+}
+
+// Writes the NumPy .npy header for a float64 matrix of rows x cols
+func WriteNpyHeader(fo *bufio.Writer, rows, cols int) {
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%d, %d), }", rows, cols)
+	// Magic, version and header length take 10 bytes; pad so that the data starts on a 64 byte boundary
+	pad := 64 - (10+len(header)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header += strings.Repeat(" ", pad) + "\n"
+	fo.WriteString("\x93NUMPY")
+	fo.WriteByte(1)
+	fo.WriteByte(0)
+	binary.Write(fo, binary.LittleEndian, uint16(len(header)))
+	fo.WriteString(header)
+}
+
+// Saves the vectors in output_format
+func SaveVectors() {
+	f, fo := CreateOutput(output_file)
+	defer f.Close()
+	switch output_format {
+	case "glove":
+		for a := 0; a < words; a++ {
+			fo.WriteString(vocab[a])
+			for b := 0; b < size; b++ {
+				fmt.Fprintf(fo, " %f", M[a*size+b])
+			}
+			fo.WriteByte('\n')
+		}
+	case "tensorboard":
+		for a := 0; a < words; a++ {
+			for b := 0; b < size; b++ {
+				if b > 0 {
+					fo.WriteByte('\t')
+				}
+				fmt.Fprintf(fo, "%f", M[a*size+b])
+			}
+			fo.WriteByte('\n')
+		}
+		fm, fmo := CreateOutput(MetaFileName())
+		defer fm.Close()
+		if counts != nil {
+			fmt.Fprintf(fmo, "word\tcount\n")
+			for a := 0; a < words; a++ {
+				fmt.Fprintf(fmo, "%s\t%d\n", vocab[a], counts[a])
+			}
+		} else {
+			// A single column metadata file must not have a header
+			for a := 0; a < words; a++ {
+				fmt.Fprintf(fmo, "%s\n", vocab[a])
+			}
+		}
+		fmo.Flush()
+	case "npy":
+		WriteNpyHeader(fo, words, size)
+		binary.Write(fo, binary.LittleEndian, M)
+		fm, fmo := CreateOutput(MetaFileName())
+		defer fm.Close()
+		for a := 0; a < words; a++ {
+			if counts != nil {
+				fmt.Fprintf(fmo, "%s %d\n", vocab[a], counts[a])
+			} else {
+				fmt.Fprintf(fmo, "%s\n", vocab[a])
+			}
+		}
+		fmo.Flush()
+	default:
+		fmt.Fprintf(fo, "%d %d\n", words, size)
+		for a := 0; a < words; a++ {
+			fmt.Fprintf(fo, "%s ", vocab[a])
+			if output_binary != 0 {
+				binary.Write(fo, binary.LittleEndian, M[a*size:(a+1)*size])
+			} else {
+				for b := 0; b < size; b++ {
+					fmt.Fprintf(fo, "%f ", M[a*size+b])
+				}
+			}
+			fmt.Fprintf(fo, "\n")
+		}
+	}
+	if err := fo.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot write %s: %v\n", output_file, err)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	args := os.Args
+	if len(args) == 1 {
+		fmt.Fprintf(os.Stderr, "WORD VECTOR conversion tool\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "\t-input <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-input-format <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tFormat of the input: word2vec or glove; default is word2vec\n")
+		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe word2vec input is in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-read-vocab <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tRead word counts from the vocabulary <file> saved by word2vec -save-vocab\n")
+		fmt.Fprintf(os.Stderr, "\t-read-vocab-format <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tFormat of the -read-vocab file: auto, text, tsv or json; auto takes the format from the extension,\n")
+		fmt.Fprintf(os.Stderr, "\t\t.tsv or .json, and text otherwise; default is auto\n")
+		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> to save the converted vectors\n")
+		fmt.Fprintf(os.Stderr, "\t-output-format <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tFormat of the output: word2vec, glove (text without header), tensorboard (projector vectors TSV\n")
+		fmt.Fprintf(os.Stderr, "\t\tplus metadata TSV) or npy (NumPy float64 matrix plus vocab file); default is word2vec\n")
+		fmt.Fprintf(os.Stderr, "\t-output-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSave the word2vec output in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-output-meta <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> for the metadata / vocab file of the tensorboard and npy formats; default is derived from -output\n")
+		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = more info)\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "./convert-vectors -input vectors.bin -binary 1 -read-vocab vocab.txt -output vectors.tsv -output-format tensorboard\n\n")
+		os.Exit(0)
+	}
+	if i := vecutil.ArgPos("-input", args); i > 0 {
+		input_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-input-format", args); i > 0 {
+		input_format = args[i+1]
+	}
+	if i := vecutil.ArgPos("-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		binaryf = int(v)
+	}
+	if i := vecutil.ArgPos("-read-vocab", args); i > 0 {
+		read_vocab_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-read-vocab-format", args); i > 0 {
+		read_vocab_format = args[i+1]
+	}
+	if read_vocab_format != "auto" && read_vocab_format != "text" && read_vocab_format != "tsv" && read_vocab_format != "json" {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown vocabulary format %s\n", read_vocab_format)
+		os.Exit(1)
+	}
+	if i := vecutil.ArgPos("-output", args); i > 0 {
+		output_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-output-format", args); i > 0 {
+		output_format = args[i+1]
+	}
+	if i := vecutil.ArgPos("-output-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		output_binary = int(v)
+	}
+	if i := vecutil.ArgPos("-output-meta", args); i > 0 {
+		output_meta_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-debug", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		debug_mode = int(v)
+	}
+	if input_format != "word2vec" && input_format != "glove" {
+		fmt.Fprintf(os.Stderr, "Unknown input format %s\n", input_format)
+		os.Exit(1)
+	}
+	switch output_format {
+	case "word2vec", "glove", "tensorboard", "npy":
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %s\n", output_format)
+		os.Exit(1)
+	}
+	if input_file == "" || output_file == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: -input and -output are required\n")
+		os.Exit(1)
+	}
+	ReadVectors()
+	if read_vocab_file != "" {
+		ReadCounts()
+	}
+	SaveVectors()
+	os.Exit(0)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"../vecutil"
+)
+
+var input1_file, input2_file, output_file string
+var binaryf int = 0
+var knn int = 10
+var max_words int = 10000
+var top int = 20
+var rank string = "jaccard"
+var format string = "text"
+var all_words int = 0
+var debug_mode int = 2
+var num_threads int = 12
+
+// Returns the model of the rows of m
+func Subset(m *vecutil.Model, rows []int) *vecutil.Model {
+	s := &vecutil.Model{Words: len(rows), Size: m.Size, Vocab: make([]string, len(rows)), Index: make(map[string]int, len(rows)),
+		M: make([]float64, len(rows)*m.Size)}
+	for a, b := range rows {
+		s.Vocab[a] = m.Vocab[b]
+		s.Index[s.Vocab[a]] = a
+		copy(s.M[a*m.Size:(a+1)*m.Size], m.M[b*m.Size:(b+1)*m.Size])
+	}
+	return s
+}
+
+type word_diff struct {
+	Word        string   `json:"word"`
+	Jaccard     float64  `json:"jaccard"`
+	Shift       float64  `json:"cosine_shift"`
+	Neighbours1 []string `json:"neighbours1"`
+	Neighbours2 []string `json:"neighbours2"`
+}
+
+type diff_report struct {
+	SharedWords int         `json:"shared_words"`
+	K           int         `json:"k"`
+	MeanJaccard float64     `json:"mean_jaccard"`
+	MeanShift   float64     `json:"mean_cosine_shift"`
+	MostChanged []word_diff `json:"most_changed"`
+	MostStable  []word_diff `json:"most_stable"`
+	Words       []word_diff `json:"words,omitempty"`
+}
+
+// Returns the top knn neighbours of every word of m, the word itself excluded
+func Neighbours(m *vecutil.Model) [][]int {
+	queries := make([]int, m.Words)
+	for a := range queries {
+		queries[a] = a
+	}
+	nn := vecutil.NearestNeighbours(m, queries, m, m.Words, knn+1, num_threads)
+	for a := range nn {
+		var keep []int
+		for _, b := range nn[a] {
+			if b != a && b >= 0 && len(keep) < knn {
+				keep = append(keep, b)
+			}
+		}
+		nn[a] = keep
+	}
+	return nn
+}
+
+// Compares the models on their shared vocabulary: the Jaccard overlap of the neighbourhoods of every word,
+// and the cosine distance between its vectors once the first model is mapped onto the second by Procrustes
+func Compare(m1, m2 *vecutil.Model) *diff_report {
+	var rows1, rows2 []int
+	for a := 0; a < m1.Words && (max_words <= 0 || len(rows1) < max_words); a++ {
+		if b, ok := m2.Index[m1.Vocab[a]]; ok {
+			rows1 = append(rows1, a)
+			rows2 = append(rows2, b)
+		}
+	}
+	n := len(rows1)
+	if n <= knn {
+		fmt.Fprintf(os.Stderr, "ERROR: the models share %d words, more than -k are needed\n", n)
+		os.Exit(1)
+	}
+	s1 := Subset(m1, rows1)
+	s2 := Subset(m2, rows2)
+	if debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "Shared words: %d\n", n)
+	}
+	nn1 := Neighbours(s1)
+	nn2 := Neighbours(s2)
+	pairs := make([][2]int, n)
+	for a := range pairs {
+		pairs[a] = [2]int{a, a}
+	}
+	W := vecutil.Procrustes(s1, s2, pairs)
+	rep := &diff_report{SharedWords: n, K: knn}
+	diffs := make([]word_diff, n)
+	d := s1.Size
+	for a := 0; a < n; a++ {
+		inter := 0
+		in1 := make(map[int]bool)
+		for _, b := range nn1[a] {
+			in1[b] = true
+		}
+		for _, b := range nn2[a] {
+			if in1[b] {
+				inter++
+			}
+		}
+		union := len(nn1[a]) + len(nn2[a]) - inter
+		// Both vectors have unit length and W is orthogonal, so the cosine is the plain dot product
+		var cos float64 = 0
+		for j := 0; j < d; j++ {
+			var x float64 = 0
+			for i := 0; i < d; i++ {
+				x += s1.M[a*d+i] * W[i*d+j]
+			}
+			cos += x * s2.M[a*d+j]
+		}
+		diffs[a] = word_diff{Word: s1.Vocab[a], Shift: 1 - cos}
+		if union > 0 {
+			diffs[a].Jaccard = float64(inter) / float64(union)
+		}
+		for _, b := range nn1[a] {
+			diffs[a].Neighbours1 = append(diffs[a].Neighbours1, s1.Vocab[b])
+		}
+		for _, b := range nn2[a] {
+			diffs[a].Neighbours2 = append(diffs[a].Neighbours2, s2.Vocab[b])
+		}
+		rep.MeanJaccard += diffs[a].Jaccard / float64(n)
+		rep.MeanShift += diffs[a].Shift / float64(n)
+	}
+	if all_words != 0 {
+		rep.Words = append([]word_diff(nil), diffs...)
+	}
+	// Most changed first: lowest overlap, or largest shift with -rank shift; the other measure breaks ties
+	sort.SliceStable(diffs, func(i, j int) bool {
+		if rank == "shift" {
+			if diffs[i].Shift != diffs[j].Shift {
+				return diffs[i].Shift > diffs[j].Shift
+			}
+			return diffs[i].Jaccard < diffs[j].Jaccard
+		}
+		if diffs[i].Jaccard != diffs[j].Jaccard {
+			return diffs[i].Jaccard < diffs[j].Jaccard
+		}
+		return diffs[i].Shift > diffs[j].Shift
+	})
+	t := top
+	if t > n {
+		t = n
+	}
+	rep.MostChanged = diffs[:t]
+	for a := n - 1; a >= n-t; a-- {
+		rep.MostStable = append(rep.MostStable, diffs[a])
+	}
+	return rep
+}
+
+// Writes the words of list as a table, with their nearest neighbours in both models
+func WriteTable(fo *bufio.Writer, title string, list []word_diff) {
+	fmt.Fprintf(fo, "\n%s:\n", title)
+	fmt.Fprintf(fo, "%30s %8s %8s  %s\n", "Word", "Jaccard", "Shift", "Neighbours (model 1 | model 2)")
+	for _, w := range list {
+		n1, n2 := w.Neighbours1, w.Neighbours2
+		if len(n1) > 5 {
+			n1 = n1[:5]
+		}
+		if len(n2) > 5 {
+			n2 = n2[:5]
+		}
+		fmt.Fprintf(fo, "%30s %8.4f %8.4f  %s | %s\n", w.Word, w.Jaccard, w.Shift, strings.Join(n1, " "), strings.Join(n2, " "))
+	}
+}
+
+// Writes the report in the requested format
+func SaveReport(rep *diff_report) {
+	fo := bufio.NewWriter(os.Stdout)
+	if output_file != "" {
+		f, err := os.Create(output_file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", output_file)
+			os.Exit(1)
+		}
+		defer f.Close()
+		fo = bufio.NewWriter(f)
+	}
+	if format == "json" {
+		enc := json.NewEncoder(fo)
+		enc.SetIndent("", "  ")
+		vecutil.FailOnError(enc.Encode(rep), "Cannot encode the report")
+	} else {
+		fmt.Fprintf(fo, "Shared words: %d\n", rep.SharedWords)
+		fmt.Fprintf(fo, "Neighbours compared: %d\n", rep.K)
+		fmt.Fprintf(fo, "Mean Jaccard overlap: %f\n", rep.MeanJaccard)
+		fmt.Fprintf(fo, "Mean cosine shift: %f\n", rep.MeanShift)
+		WriteTable(fo, "Most changed words", rep.MostChanged)
+		WriteTable(fo, "Most stable words", rep.MostStable)
+		if rep.Words != nil {
+			WriteTable(fo, "All words", rep.Words)
+		}
+	}
+	if err := fo.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot write the report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	args := os.Args
+	if len(args) == 1 {
+		fmt.Fprintf(os.Stderr, "DIFF VECTORS tool\n\n")
+		fmt.Fprintf(os.Stderr, "Finds the words whose meaning differs between two models\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "\t-input1 <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse the first word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-input2 <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse the second word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe vectors are in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> to save the report; default is standard output\n")
+		fmt.Fprintf(os.Stderr, "\t-format <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tReport format: text or json; default is text\n")
+		fmt.Fprintf(os.Stderr, "\t-k <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tNumber of nearest neighbours compared for every word; default is 10\n")
+		fmt.Fprintf(os.Stderr, "\t-words <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tCompare only the <int> most frequent shared words (in the order of the first model); the\n")
+		fmt.Fprintf(os.Stderr, "\t\tneighbour search is quadratic in this number; default is 10000 (0 means all)\n")
+		fmt.Fprintf(os.Stderr, "\t-top <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tNumber of most changed and most stable words listed; default is 20\n")
+		fmt.Fprintf(os.Stderr, "\t-rank <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tRank the words by jaccard (neighbourhood overlap) or shift (cosine distance after alignment);\n")
+		fmt.Fprintf(os.Stderr, "\t\tdefault is jaccard\n")
+		fmt.Fprintf(os.Stderr, "\t-all <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tAlso report every compared word; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-threads <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <int> threads (default 12)\n")
+		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = more info)\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "./diff-vectors -input1 2023.bin -input2 2024.bin -binary 1 -k 20 -top 50 -format json -output diff.json\n\n")
+		os.Exit(0)
+	}
+	if i := vecutil.ArgPos("-input1", args); i > 0 {
+		input1_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-input2", args); i > 0 {
+		input2_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		binaryf = int(v)
+	}
+	if i := vecutil.ArgPos("-output", args); i > 0 {
+		output_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-format", args); i > 0 {
+		format = args[i+1]
+	}
+	if i := vecutil.ArgPos("-k", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		knn = int(v)
+	}
+	if i := vecutil.ArgPos("-words", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		max_words = int(v)
+	}
+	if i := vecutil.ArgPos("-top", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		top = int(v)
+	}
+	if i := vecutil.ArgPos("-rank", args); i > 0 {
+		rank = args[i+1]
+	}
+	if i := vecutil.ArgPos("-all", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		all_words = int(v)
+	}
+	if i := vecutil.ArgPos("-threads", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		num_threads = int(v)
+		if num_threads < 1 {
+			num_threads = 1
+		}
+	}
+	if i := vecutil.ArgPos("-debug", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		debug_mode = int(v)
+	}
+	if input1_file == "" || input2_file == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: -input1 and -input2 are required\n")
+		os.Exit(1)
+	}
+	if format != "text" && format != "json" {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown format %s\n", format)
+		os.Exit(1)
+	}
+	if rank != "jaccard" && rank != "shift" {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown ranking %s\n", rank)
+		os.Exit(1)
+	}
+	if knn <= 0 || top < 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: -k must be positive and -top must not be negative\n")
+		os.Exit(1)
+	}
+	m1 := vecutil.ReadVectors(input1_file, binaryf != 0, debug_mode > 0)
+	m2 := vecutil.ReadVectors(input2_file, binaryf != 0, debug_mode > 0)
+	if m1.Size != m2.Size {
+		fmt.Fprintf(os.Stderr, "ERROR: the first vectors have %d dimensions and the second %d\n", m1.Size, m2.Size)
+		os.Exit(1)
+	}
+	m1.Normalize()
+	m2.Normalize()
+	SaveReport(Compare(m1, m2))
+	os.Exit(0)
+}
@@ -4,10 +4,11 @@ import (
 	"bufio"
 	"encoding/binary"
 	"fmt"
-	"log"
 	"math"
 	"os"
 	"strings"
+
+	"../vecutil"
 )
 
 const max_size int = 2000 // max length of strings
@@ -18,12 +19,10 @@ func main() {
 	args := os.Args
 	var st1 string
 	var bestw []string = make([]string, N)
-	var st []string
 	var dist, length float64
 	var bestd []float64 = make([]float64, N)
 	var vec []float64 = make([]float64, max_size)
-	var words, size, a, b, c, d, cn int
-	var bi []int = make([]int, 100)
+	var words, size, a, b, c, d int
 	if len(args) < 2 {
 		fmt.Fprintf(os.Stderr, "Usage: ./distance <FILE>\nwhere FILE contains word projections in the BINARY FORMAT\n")
 		os.Exit(0)
@@ -47,7 +46,7 @@ func main() {
 		vocab[b] = vocab[b][:len(vocab[b])-1]
 		vocab[b] = strings.Replace(vocab[b], "\n", "", -1)
 		err = binary.Read(br, binary.LittleEndian, M[b*size:b*size+size])
-		failOnError(err, "Cannot read input file")
+		vecutil.FailOnError(err, "Cannot read input file")
 		length = 0
 		for a = 0; a < size; a++ {
 			length += M[a+b*size] * M[a+b*size]
@@ -65,7 +64,7 @@ func main() {
 		for a = 0; a < N; a++ {
 			bestw[a] = ""
 		}
-		fmt.Printf("Enter word or sentence (EXIT to break): ")
+		fmt.Printf("Enter word, sentence or expression (EXIT to break): ")
 		sf := scanner.Scan()
 		if !sf {
 			break
@@ -74,49 +73,19 @@ func main() {
 		if st1 == "EXIT" {
 			break
 		}
-		b = 0
-		c = 0
-		st = strings.Split(st1, " ")
-		cn = len(st)
-		for a = 0; a < cn; a++ {
-			for b = 0; b < words; b++ {
-				if vocab[b] == st[a] {
-					break
-				}
-			}
-			if b == words {
-				b = -1
-			}
-			bi[a] = b
-			fmt.Printf("\nWord: %s  Position in vocabulary: %d\n", st[a], bi[a])
-			if b == -1 {
-				fmt.Printf("Out of dictionary word!\n")
-				break
-			}
-		}
-		if b == -1 {
+		terms, err := vecutil.ParseQuery(st1, vocab)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
 			continue
 		}
-		fmt.Printf("\n                                              Word       Cosine distance\n------------------------------------------------------------------------\n")
-		for a = 0; a < size; a++ {
-			vec[a] = 0
+		for _, t := range terms {
+			fmt.Printf("\nWord: %s  Weight: %g  Position in vocabulary: %d\n", t.Word, t.Weight, t.Index)
 		}
-		for b = 0; b < cn; b++ {
-			if bi[b] == -1 {
-				continue
-			}
-			for a = 0; a < size; a++ {
-				vec[a] += M[a+bi[b]*size]
-			}
-		}
-		length = 0
-		for a = 0; a < size; a++ {
-			length += vec[a] * vec[a]
-		}
-		length = math.Sqrt(length)
-		for a = 0; a < size; a++ {
-			vec[a] /= length
+		if err := vecutil.QueryVector(terms, M, vec, size); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
 		}
+		fmt.Printf("\n                                              Word       Cosine distance\n------------------------------------------------------------------------\n")
 		for a = 0; a < N; a++ {
 			bestd[a] = -1
 		}
@@ -124,9 +93,10 @@ func main() {
 			bestw[a] = ""
 		}
 		for c = 0; c < words; c++ {
+			// Skip the words of the query
 			a = 0
-			for b = 0; b < len(bi); b++ {
-				if bi[b] == c {
+			for _, t := range terms {
+				if t.Index == c {
 					a = 1
 				}
 			}
@@ -155,10 +125,3 @@ func main() {
 	}
 	os.Exit(0)
 }
-
-func failOnError(err error, msg string) {
-	if err != nil {
-		log.Fatalf("%s: %s", msg, err)
-		panic(fmt.Sprintf("%s: %s", msg, err))
-	}
-}
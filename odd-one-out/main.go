@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"../vecutil"
+)
+
+var input_file, query_file, output_file string
+var binaryf int = 0
+var debug_mode int = 2
+var words, size int
+var vocab []string
+var vocab_index map[string]int
+var M []float64
+
+type set_result struct {
+	words     []string
+	sim       []float64 // Cosine similarity of every word to the centroid of the set
+	odd       int       // Position of the word farthest from the centroid
+	coherence float64   // Mean pairwise cosine similarity
+}
+
+// Returns the odd one out, the coherence and the centroid similarities of the set of words st
+func QuerySet(st []string) (*set_result, error) {
+	if len(st) < 3 {
+		return nil, fmt.Errorf("%d words were entered, at least three are needed", len(st))
+	}
+	bi := make([]int, len(st))
+	seen := make(map[string]bool)
+	for a, w := range st {
+		b, ok := vocab_index[w]
+		if !ok {
+			return nil, fmt.Errorf("out of dictionary word %q", w)
+		}
+		if seen[w] {
+			return nil, fmt.Errorf("word %q is repeated", w)
+		}
+		seen[w] = true
+		bi[a] = b
+	}
+	res := &set_result{words: st, sim: make([]float64, len(st))}
+	cent := make([]float64, size)
+	for _, b := range bi {
+		for a := 0; a < size; a++ {
+			cent[a] += M[a+b*size] / float64(len(bi))
+		}
+	}
+	var length float64 = 0
+	for a := 0; a < size; a++ {
+		length += cent[a] * cent[a]
+	}
+	length = math.Sqrt(length)
+	for c, b := range bi {
+		var dist float64 = 0
+		for a := 0; a < size; a++ {
+			dist += cent[a] * M[a+b*size]
+		}
+		if length > 0 {
+			dist /= length
+		}
+		res.sim[c] = dist
+		if dist < res.sim[res.odd] {
+			res.odd = c
+		}
+	}
+	pairs := 0
+	for c := 0; c < len(bi); c++ {
+		for d := c + 1; d < len(bi); d++ {
+			var dist float64 = 0
+			for a := 0; a < size; a++ {
+				dist += M[a+bi[c]*size] * M[a+bi[d]*size]
+			}
+			res.coherence += dist
+			pairs++
+		}
+	}
+	res.coherence /= float64(pairs)
+	return res, nil
+}
+
+// Prints the result of an interactive query, the words sorted by their similarity to the centroid
+func PrintResult(res *set_result) {
+	fmt.Printf("\nOdd one out: %s\n", res.words[res.odd])
+	fmt.Printf("Mean pairwise cosine: %f\n", res.coherence)
+	order := make([]int, len(res.words))
+	for a := range order {
+		order[a] = a
+	}
+	sort.SliceStable(order, func(i, j int) bool { return res.sim[order[i]] > res.sim[order[j]] })
+	fmt.Printf("\n                                              Word   Centroid similarity\n------------------------------------------------------------------------\n")
+	for _, a := range order {
+		fmt.Printf("%50s\t\t%f\n", res.words[a], res.sim[a])
+	}
+}
+
+// Reads one set of words per line from query_file and writes, for every set, the odd one out, the mean
+// pairwise cosine and the centroid similarity of every word in input order, separated by tabs
+func RunBatch() {
+	fi, err := os.Open(query_file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: query file %s not found\n", query_file)
+		os.Exit(1)
+	}
+	defer fi.Close()
+	fo := bufio.NewWriter(os.Stdout)
+	if output_file != "" {
+		f, err := os.Create(output_file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", output_file)
+			os.Exit(1)
+		}
+		defer f.Close()
+		fo = bufio.NewWriter(f)
+	}
+	scanner := bufio.NewScanner(fi)
+	line := 0
+	for scanner.Scan() {
+		line++
+		st := strings.Fields(scanner.Text())
+		if len(st) == 0 {
+			continue
+		}
+		res, err := QuerySet(st)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s:%d: %v\n", query_file, line, err)
+			continue
+		}
+		fmt.Fprintf(fo, "%s\t%f", res.words[res.odd], res.coherence)
+		for a := range res.words {
+			fmt.Fprintf(fo, "\t%s:%f", res.words[a], res.sim[a])
+		}
+		fmt.Fprintf(fo, "\n")
+	}
+	vecutil.FailOnError(scanner.Err(), "Cannot read query file")
+	if err := fo.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot write the results: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Answers queries typed on the standard input
+func RunInteractive() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Printf("Enter at least three words (EXIT to break): ")
+		if !scanner.Scan() {
+			break
+		}
+		st1 := scanner.Text()
+		if st1 == "EXIT" {
+			break
+		}
+		res, err := QuerySet(strings.Fields(st1))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
+		}
+		PrintResult(res)
+	}
+}
+
+func main() {
+	args := os.Args
+	if len(args) == 1 {
+		fmt.Fprintf(os.Stderr, "ODD ONE OUT tool\n\n")
+		fmt.Fprintf(os.Stderr, "Finds the word of a set that does not belong, and measures how coherent the set is\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "\t-input <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe vectors are in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-query <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tRead one set of words per line from <file> instead of asking for them interactively\n")
+		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tWrite the -query results to <file>, one line per set: the odd one out, the mean pairwise cosine\n")
+		fmt.Fprintf(os.Stderr, "\t\tand word:similarity to the centroid for every word, separated by tabs; default is standard output\n")
+		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = more info)\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "./odd-one-out -input vectors.bin -binary 1\n")
+		fmt.Fprintf(os.Stderr, "./odd-one-out -input vectors.bin -binary 1 -query sets.txt -output odd.tsv\n\n")
+		os.Exit(0)
+	}
+	if i := vecutil.ArgPos("-input", args); i > 0 {
+		input_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		binaryf = int(v)
+	}
+	if i := vecutil.ArgPos("-query", args); i > 0 {
+		query_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-output", args); i > 0 {
+		output_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-debug", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		debug_mode = int(v)
+	}
+	if input_file == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: -input is required\n")
+		os.Exit(1)
+	}
+	m := vecutil.ReadVectors(input_file, binaryf != 0, debug_mode > 0)
+	m.Normalize()
+	words, size, vocab, vocab_index, M = m.Words, m.Size, m.Vocab, m.Index, m.M
+	if query_file != "" {
+		RunBatch()
+	} else {
+		RunInteractive()
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"../vecutil"
+)
+
+var input_file, output_file string
+var binaryf int = 0
+var output_binary int = -1 // Negative means the format of the input
+var steps string = "center,remove-top=2,normalize"
+var debug_mode int = 2
+var num_threads int = 12
+var words, size int
+var vocab []string
+var M []float64
+
+// Returns the covariance matrix of the rows of the centred n x d matrix X
+func Covariance(X []float64, n, d int) []float64 {
+	part := make([][]float64, num_threads)
+	vecutil.ParallelRange(n, num_threads, func(id, lo, hi int) {
+		c := make([]float64, d*d)
+		for i := lo; i < hi; i++ {
+			x := X[i*d : (i+1)*d]
+			for p := 0; p < d; p++ {
+				for q := p; q < d; q++ {
+					c[p*d+q] += x[p] * x[q]
+				}
+			}
+		}
+		part[id] = c
+	})
+	C := make([]float64, d*d)
+	for _, c := range part {
+		for a := range c {
+			C[a] += c[a]
+		}
+	}
+	for p := 0; p < d; p++ {
+		for q := p; q < d; q++ {
+			C[p*d+q] /= float64(n - 1)
+			C[q*d+p] = C[p*d+q]
+		}
+	}
+	return C
+}
+
+// Subtracts the mean vector from every word vector
+func Center() {
+	mean := make([]float64, size)
+	for b := 0; b < words; b++ {
+		for a := 0; a < size; a++ {
+			mean[a] += M[b*size+a] / float64(words)
+		}
+	}
+	for b := 0; b < words; b++ {
+		for a := 0; a < size; a++ {
+			M[b*size+a] -= mean[a]
+		}
+	}
+}
+
+// Centres the vectors and removes their projections on the top d principal components ("all-but-the-top")
+func RemoveTop(d int) {
+	Center()
+	vals, comp := vecutil.SymmetricEigen(Covariance(M, words, size), size)
+	if debug_mode > 1 {
+		for c := 0; c < d; c++ {
+			fmt.Fprintf(os.Stderr, "Removing component %d with variance %f\n", c+1, vals[c])
+		}
+	}
+	vecutil.ParallelRange(words, num_threads, func(id, lo, hi int) {
+		for b := lo; b < hi; b++ {
+			x := M[b*size : (b+1)*size]
+			for c := 0; c < d; c++ {
+				u := comp[c*size : (c+1)*size]
+				var s float64 = 0
+				for a := 0; a < size; a++ {
+					s += x[a] * u[a]
+				}
+				for a := 0; a < size; a++ {
+					x[a] -= s * u[a]
+				}
+			}
+		}
+	})
+}
+
+// Scales every word vector to unit length
+func Normalize() {
+	for b := 0; b < words; b++ {
+		var length float64 = 0
+		for a := 0; a < size; a++ {
+			length += M[b*size+a] * M[b*size+a]
+		}
+		length = math.Sqrt(length)
+		if length == 0 {
+			continue
+		}
+		for a := 0; a < size; a++ {
+			M[b*size+a] /= length
+		}
+	}
+}
+
+// Centres the vectors and decorrelates them with unit variance in every direction (ZCA whitening);
+// directions without variance are dropped
+func Whiten() {
+	Center()
+	vals, comp := vecutil.SymmetricEigen(Covariance(M, words, size), size)
+	// W = U diag(1 / sqrt(vals)) U^T
+	W := make([]float64, size*size)
+	for c := 0; c < size; c++ {
+		if vals[c] <= 1e-12*vals[0] {
+			continue
+		}
+		s := 1 / math.Sqrt(vals[c])
+		for p := 0; p < size; p++ {
+			for q := 0; q < size; q++ {
+				W[p*size+q] += comp[c*size+p] * s * comp[c*size+q]
+			}
+		}
+	}
+	vecutil.ParallelRange(words, num_threads, func(id, lo, hi int) {
+		y := make([]float64, size)
+		for b := lo; b < hi; b++ {
+			x := M[b*size : (b+1)*size]
+			for p := 0; p < size; p++ {
+				var s float64 = 0
+				for q := 0; q < size; q++ {
+					s += W[p*size+q] * x[q]
+				}
+				y[p] = s
+			}
+			copy(x, y)
+		}
+	})
+}
+
+type post_step struct {
+	name string
+	d    int // Components removed by remove-top
+}
+
+// Parses the comma separated steps; remove-top takes the number of components as remove-top=<int>
+func ParseSteps() []post_step {
+	var list []post_step
+	for _, step := range strings.Split(steps, ",") {
+		name, arg, has_arg := strings.Cut(strings.TrimSpace(step), "=")
+		switch {
+		case (name == "center" || name == "normalize" || name == "whiten") && !has_arg:
+			list = append(list, post_step{name, 0})
+		case name == "remove-top":
+			d := 1
+			if has_arg {
+				v, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil || v < 0 || int(v) > size {
+					fmt.Fprintf(os.Stderr, "ERROR: invalid number of components in step %s\n", step)
+					os.Exit(1)
+				}
+				d = int(v)
+			}
+			list = append(list, post_step{name, d})
+		default:
+			fmt.Fprintf(os.Stderr, "ERROR: unknown step %s\n", step)
+			os.Exit(1)
+		}
+	}
+	return list
+}
+
+// Applies the steps in order
+func RunSteps(list []post_step) {
+	for _, step := range list {
+		if debug_mode > 0 {
+			fmt.Fprintf(os.Stderr, "Step: %s\n", step.name)
+		}
+		switch step.name {
+		case "center":
+			Center()
+		case "remove-top":
+			RemoveTop(step.d)
+		case "normalize":
+			Normalize()
+		case "whiten":
+			Whiten()
+		}
+	}
+}
+
+func main() {
+	args := os.Args
+	if len(args) == 1 {
+		fmt.Fprintf(os.Stderr, "POST-PROCESS VECTORS tool\n\n")
+		fmt.Fprintf(os.Stderr, "Applies a chain of transforms to word vectors\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "\t-input <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe input vectors are in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> to save the transformed word vectors\n")
+		fmt.Fprintf(os.Stderr, "\t-output-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSave the vectors in binary mode; default is the mode of the input\n")
+		fmt.Fprintf(os.Stderr, "\t-steps <list>\n")
+		fmt.Fprintf(os.Stderr, "\t\tComma separated steps applied in order: center (subtract the mean vector), remove-top=<int>\n")
+		fmt.Fprintf(os.Stderr, "\t\t(center, then remove the top <int> principal components), normalize (unit length) and whiten\n")
+		fmt.Fprintf(os.Stderr, "\t\t(center, then decorrelate to unit variance); default is center,remove-top=2,normalize\n")
+		fmt.Fprintf(os.Stderr, "\t-threads <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <int> threads (default 12)\n")
+		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = more info during the steps)\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "./postprocess-vectors -input vectors.bin -binary 1 -output vectors-abtt.bin -steps center,remove-top=3,normalize\n\n")
+		os.Exit(0)
+	}
+	if i := vecutil.ArgPos("-input", args); i > 0 {
+		input_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		binaryf = int(v)
+	}
+	if i := vecutil.ArgPos("-output", args); i > 0 {
+		output_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-output-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		output_binary = int(v)
+	}
+	if i := vecutil.ArgPos("-steps", args); i > 0 {
+		steps = args[i+1]
+	}
+	if i := vecutil.ArgPos("-threads", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		num_threads = int(v)
+		if num_threads < 1 {
+			num_threads = 1
+		}
+	}
+	if i := vecutil.ArgPos("-debug", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		debug_mode = int(v)
+	}
+	if input_file == "" || output_file == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: -input and -output are required\n")
+		os.Exit(1)
+	}
+	if output_binary < 0 {
+		output_binary = binaryf
+	}
+	m := vecutil.ReadVectors(input_file, binaryf != 0, debug_mode > 0)
+	words, size, vocab, M = m.Words, m.Size, m.Vocab, m.M
+	if words < 2 {
+		fmt.Fprintf(os.Stderr, "ERROR: at least two word vectors are needed\n")
+		os.Exit(1)
+	}
+	RunSteps(ParseSteps())
+	vecutil.SaveVectors(output_file, vocab, M, size, output_binary != 0)
+	os.Exit(0)
+}
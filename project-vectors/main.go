@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"../vecutil"
+)
+
+const TSNE_TOP int = 5000 // Default -top of t-SNE, whose neighbour search grows with the square of the words
+
+var input_file, output_file, svg_file, words_file string
+var binaryf int = 0
+var method string = "tsne"
+var top int = -1 // Not given: all words for pca, TSNE_TOP words for tsne
+var normalize int = 1
+var debug_mode int = 2
+var num_threads int = 12
+var words, size int
+var vocab []string
+var vocab_index map[string]int
+var M []float64
+
+// Returns the rows to project: the words listed in words_file, or else the top most frequent words
+// The vectors of word2vec are sorted by frequency; the sentence marker </s> is skipped
+func SelectRows() []int {
+	var rows []int
+	if words_file != "" {
+		f, err := os.Open(words_file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: word list %s not found\n", words_file)
+			os.Exit(1)
+		}
+		defer f.Close()
+		seen := make(map[int]bool)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			for _, w := range strings.Fields(scanner.Text()) {
+				b, ok := vocab_index[w]
+				if !ok {
+					fmt.Fprintf(os.Stderr, "Out of dictionary word: %s\n", w)
+					continue
+				}
+				if !seen[b] {
+					seen[b] = true
+					rows = append(rows, b)
+				}
+			}
+		}
+		vecutil.FailOnError(scanner.Err(), "Cannot read word list")
+		return rows
+	}
+	for b := 0; b < words && (top <= 0 || len(rows) < top); b++ {
+		if vocab[b] != "</s>" {
+			rows = append(rows, b)
+		}
+	}
+	return rows
+}
+
+// Returns the projection of the rows of X on their first two principal components, found by subspace iteration
+func PCA2(X []float64, n, d int) []float64 {
+	var next_random uint64 = 1
+	mean := make([]float64, d)
+	for i := 0; i < n; i++ {
+		for a := 0; a < d; a++ {
+			mean[a] += X[i*d+a] / float64(n)
+		}
+	}
+	V := make([]float64, 2*d)
+	for a := range V {
+		next_random = next_random*uint64(25214903917) + 11
+		V[a] = float64(next_random&0xFFFF)/float64(65536) - 0.5
+	}
+	x := make([]float64, d)
+	for it := 0; it < 100; it++ {
+		W := make([]float64, 2*d)
+		for i := 0; i < n; i++ {
+			for a := 0; a < d; a++ {
+				x[a] = X[i*d+a] - mean[a]
+			}
+			for c := 0; c < 2; c++ {
+				var s float64 = 0
+				for a := 0; a < d; a++ {
+					s += x[a] * V[c*d+a]
+				}
+				for a := 0; a < d; a++ {
+					W[c*d+a] += s * x[a]
+				}
+			}
+		}
+		// Gram-Schmidt orthonormalization
+		for c := 0; c < 2; c++ {
+			for e := 0; e < c; e++ {
+				var s float64 = 0
+				for a := 0; a < d; a++ {
+					s += W[c*d+a] * W[e*d+a]
+				}
+				for a := 0; a < d; a++ {
+					W[c*d+a] -= s * W[e*d+a]
+				}
+			}
+			var length float64 = 0
+			for a := 0; a < d; a++ {
+				length += W[c*d+a] * W[c*d+a]
+			}
+			length = math.Sqrt(length)
+			if length == 0 {
+				continue
+			}
+			for a := 0; a < d; a++ {
+				W[c*d+a] /= length
+			}
+		}
+		V = W
+	}
+	Y := make([]float64, 2*n)
+	for i := 0; i < n; i++ {
+		for c := 0; c < 2; c++ {
+			for a := 0; a < d; a++ {
+				Y[2*i+c] += (X[i*d+a] - mean[a]) * V[c*d+a]
+			}
+		}
+	}
+	return Y
+}
+
+// Writes the labelled 2-D coordinates as TSV
+func SaveTSV(labels []string, Y []float64) {
+	fo := bufio.NewWriter(os.Stdout)
+	if output_file != "" {
+		f, err := os.Create(output_file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", output_file)
+			os.Exit(1)
+		}
+		defer f.Close()
+		fo = bufio.NewWriter(f)
+	}
+	fmt.Fprintf(fo, "word\tx\ty\n")
+	for i, w := range labels {
+		fmt.Fprintf(fo, "%s\t%f\t%f\n", w, Y[2*i], Y[2*i+1])
+	}
+	if err := fo.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot write the coordinates: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Writes a self-contained SVG scatter plot of the labelled points
+func SaveSVG(labels []string, Y []float64) {
+	const width, margin float64 = 1000, 50
+	f, err := os.Create(svg_file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", svg_file)
+		os.Exit(1)
+	}
+	defer f.Close()
+	fo := bufio.NewWriter(f)
+	minx, maxx, miny, maxy := math.MaxFloat64, -math.MaxFloat64, math.MaxFloat64, -math.MaxFloat64
+	for i := range labels {
+		minx = math.Min(minx, Y[2*i])
+		maxx = math.Max(maxx, Y[2*i])
+		miny = math.Min(miny, Y[2*i+1])
+		maxy = math.Max(maxy, Y[2*i+1])
+	}
+	scale := (width - 2*margin) / math.Max(math.Max(maxx-minx, maxy-miny), 1e-12)
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+	fmt.Fprintf(fo, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" viewBox=\"0 0 %.0f %.0f\">\n", width, width, width, width)
+	fmt.Fprintf(fo, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n")
+	fmt.Fprintf(fo, "<g font-family=\"sans-serif\" font-size=\"10\">\n")
+	for i, w := range labels {
+		// SVG y grows downwards
+		x := margin + (Y[2*i]-minx)*scale
+		y := width - margin - (Y[2*i+1]-miny)*scale
+		fmt.Fprintf(fo, "<circle cx=\"%.2f\" cy=\"%.2f\" r=\"2\" fill=\"steelblue\"/>", x, y)
+		fmt.Fprintf(fo, "<text x=\"%.2f\" y=\"%.2f\">%s</text>\n", x+3, y-3, escape.Replace(w))
+	}
+	fmt.Fprintf(fo, "</g>\n</svg>\n")
+	if err := fo.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot write %s: %v\n", svg_file, err)
+		os.Exit(1)
+	}
+}
+
+func main() {
+	args := os.Args
+	if len(args) == 1 {
+		fmt.Fprintf(os.Stderr, "PROJECT VECTORS tool\n\n")
+		fmt.Fprintf(os.Stderr, "Projects word vectors to two dimensions for visualization\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "\t-input <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe vectors are in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> to save the coordinates as TSV with the columns word, x and y; default is standard output\n")
+		fmt.Fprintf(os.Stderr, "\t-svg <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tAlso save a labelled scatter plot to <file> as SVG\n")
+		fmt.Fprintf(os.Stderr, "\t-words <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tProject only the words listed in <file>, separated by spaces or newlines\n")
+		fmt.Fprintf(os.Stderr, "\t-top <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tWithout -words, project the <int> most frequent words, 0 for all words; default is all words for pca\n")
+		fmt.Fprintf(os.Stderr, "\t\tand %d for tsne, whose neighbour search compares every pair of words and so grows with the square\n", TSNE_TOP)
+		fmt.Fprintf(os.Stderr, "\t\tof the number of words\n")
+		fmt.Fprintf(os.Stderr, "\t-method <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tProjection method: pca or tsne (Barnes-Hut t-SNE); default is tsne\n")
+		fmt.Fprintf(os.Stderr, "\t-normalize <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tScale the vectors to unit length first, so that distances follow cosine similarity; default is 1\n")
+		fmt.Fprintf(os.Stderr, "\t-perplexity <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tt-SNE perplexity, the effective number of neighbours of each word; only the 3 * <float> nearest\n")
+		fmt.Fprintf(os.Stderr, "\t\twords of each word are kept; default is 30\n")
+		fmt.Fprintf(os.Stderr, "\t-iter <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tNumber of t-SNE iterations; default is 1000\n")
+		fmt.Fprintf(os.Stderr, "\t-theta <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tBarnes-Hut accuracy; 0 computes the exact gradient, larger values are faster; default is 0.5\n")
+		fmt.Fprintf(os.Stderr, "\t-threads <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <int> threads (default 12)\n")
+		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = more info during t-SNE)\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "./project-vectors -input vectors.bin -binary 1 -top 2000 -output coords.tsv -svg plot.svg\n\n")
+		os.Exit(0)
+	}
+	if i := vecutil.ArgPos("-input", args); i > 0 {
+		input_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		binaryf = int(v)
+	}
+	if i := vecutil.ArgPos("-output", args); i > 0 {
+		output_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-svg", args); i > 0 {
+		svg_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-words", args); i > 0 {
+		words_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-top", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		top = int(v)
+	}
+	if i := vecutil.ArgPos("-method", args); i > 0 {
+		method = args[i+1]
+	}
+	if i := vecutil.ArgPos("-normalize", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		normalize = int(v)
+	}
+	if i := vecutil.ArgPos("-perplexity", args); i > 0 {
+		perplexity, _ = strconv.ParseFloat(args[i+1], 64)
+	}
+	if i := vecutil.ArgPos("-iter", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		tsne_iter = int(v)
+	}
+	if i := vecutil.ArgPos("-theta", args); i > 0 {
+		theta, _ = strconv.ParseFloat(args[i+1], 64)
+	}
+	if i := vecutil.ArgPos("-threads", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		num_threads = int(v)
+		if num_threads < 1 {
+			num_threads = 1
+		}
+	}
+	if i := vecutil.ArgPos("-debug", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		debug_mode = int(v)
+	}
+	if input_file == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: -input is required\n")
+		os.Exit(1)
+	}
+	if method != "pca" && method != "tsne" {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown method %s\n", method)
+		os.Exit(1)
+	}
+	if perplexity <= 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: -perplexity must be positive\n")
+		os.Exit(1)
+	}
+	if top < 0 {
+		top = 0
+		if method == "tsne" {
+			top = TSNE_TOP
+		}
+	}
+	m := vecutil.ReadVectors(input_file, binaryf != 0, debug_mode > 0)
+	words, size, vocab, vocab_index, M = m.Words, m.Size, m.Vocab, m.Index, m.M
+	if words_file == "" && top > 0 && words > top && debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "Projecting the %d most frequent words; use -top to change it\n", top)
+	}
+	rows := SelectRows()
+	n := len(rows)
+	if n == 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: no words to project\n")
+		os.Exit(1)
+	}
+	if debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "Projecting %d words with %s\n", n, method)
+	}
+	labels := make([]string, n)
+	X := make([]float64, n*size)
+	for i, b := range rows {
+		labels[i] = vocab[b]
+		copy(X[i*size:(i+1)*size], M[b*size:(b+1)*size])
+		if normalize != 0 {
+			var length float64 = 0
+			for a := 0; a < size; a++ {
+				length += X[i*size+a] * X[i*size+a]
+			}
+			length = math.Sqrt(length)
+			for a := 0; a < size && length > 0; a++ {
+				X[i*size+a] /= length
+			}
+		}
+	}
+	var Y []float64
+	if method == "pca" {
+		Y = PCA2(X, n, size)
+	} else {
+		Y = TSNE(X, n, size)
+	}
+	SaveTSV(labels, Y)
+	if svg_file != "" {
+		SaveSVG(labels, Y)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"../vecutil"
+)
+
+var perplexity float64 = 30
+var tsne_iter int = 1000
+var theta float64 = 0.5
+
+// A cell of the Barnes-Hut quadtree over the 2-D embedding
+type quad_node struct {
+	cx, cy, hw float64 // Centre and half width of the cell
+	mx, my     float64 // Centre of mass of the points in the cell
+	n          int
+	points     []int // Points of a leaf
+	child      []*quad_node
+}
+
+// Returns the child cell of q that contains point i
+func (q *quad_node) Quadrant(Y []float64, i int) int {
+	c := 0
+	if Y[2*i] > q.cx {
+		c |= 1
+	}
+	if Y[2*i+1] > q.cy {
+		c |= 2
+	}
+	return c
+}
+
+// Adds point i to the subtree of q
+func (q *quad_node) Insert(Y []float64, i, depth int) {
+	q.mx = (q.mx*float64(q.n) + Y[2*i]) / float64(q.n+1)
+	q.my = (q.my*float64(q.n) + Y[2*i+1]) / float64(q.n+1)
+	q.n++
+	if q.child == nil {
+		// Identical points cannot be separated, so leaves deep enough keep all of them
+		if len(q.points) == 0 || depth >= 50 {
+			q.points = append(q.points, i)
+			return
+		}
+		q.child = make([]*quad_node, 4)
+		h := q.hw / 2
+		for c := 0; c < 4; c++ {
+			q.child[c] = &quad_node{cx: q.cx - h, cy: q.cy - h, hw: h}
+			if c&1 != 0 {
+				q.child[c].cx = q.cx + h
+			}
+			if c&2 != 0 {
+				q.child[c].cy = q.cy + h
+			}
+		}
+		for _, j := range q.points {
+			q.child[q.Quadrant(Y, j)].Insert(Y, j, depth+1)
+		}
+		q.points = nil
+	}
+	q.child[q.Quadrant(Y, i)].Insert(Y, i, depth+1)
+}
+
+// Adds the unnormalized repulsive force of the points of q on point i to f and returns their contribution
+// to the normalization term; cells seen under an angle below theta are summarized by their centre of mass
+func (q *quad_node) Repulsion(Y []float64, i int, f []float64) float64 {
+	if q.n == 0 {
+		return 0
+	}
+	x, y := Y[2*i], Y[2*i+1]
+	var z float64 = 0
+	if q.child == nil {
+		for _, j := range q.points {
+			if j == i {
+				continue
+			}
+			dx, dy := x-Y[2*j], y-Y[2*j+1]
+			w := 1 / (1 + dx*dx + dy*dy)
+			z += w
+			f[0] += w * w * dx
+			f[1] += w * w * dy
+		}
+		return z
+	}
+	dx, dy := x-q.mx, y-q.my
+	d2 := dx*dx + dy*dy
+	if 4*q.hw*q.hw < theta*theta*d2 {
+		w := 1 / (1 + d2)
+		n := float64(q.n)
+		f[0] += n * w * w * dx
+		f[1] += n * w * w * dy
+		return n * w
+	}
+	for _, c := range q.child {
+		z += c.Repulsion(Y, i, f)
+	}
+	return z
+}
+
+// Builds the quadtree of the n points of Y
+func BuildQuadTree(Y []float64, n int) *quad_node {
+	minx, maxx, miny, maxy := math.MaxFloat64, -math.MaxFloat64, math.MaxFloat64, -math.MaxFloat64
+	for i := 0; i < n; i++ {
+		minx = math.Min(minx, Y[2*i])
+		maxx = math.Max(maxx, Y[2*i])
+		miny = math.Min(miny, Y[2*i+1])
+		maxy = math.Max(maxy, Y[2*i+1])
+	}
+	hw := math.Max(maxx-minx, maxy-miny)/2 + 1e-5
+	root := &quad_node{cx: (minx + maxx) / 2, cy: (miny + maxy) / 2, hw: hw}
+	for i := 0; i < n; i++ {
+		root.Insert(Y, i, 0)
+	}
+	return root
+}
+
+// Returns the symmetric input similarities of the rows of X over their nearest neighbours, as neighbour
+// lists and weights; the conditional distributions are calibrated to the requested perplexity
+func InputSimilarities(X []float64, n, d int) ([][]int, [][]float64) {
+	k := int(3 * perplexity)
+	if k > n-1 {
+		k = n - 1
+	}
+	nbr := make([][]int, n)
+	cond := make([][]float64, n)
+	vecutil.ParallelRange(n, num_threads, func(id, lo, hi int) {
+		dist := make([]float64, k)
+		for i := lo; i < hi; i++ {
+			// Keep the k nearest rows sorted by distance; a row is inserted only if it is nearer than the
+			// farthest one kept, so no full sort of the n distances is needed
+			nbr[i] = make([]int, 0, k)
+			for j := 0; j < n; j++ {
+				if j == i {
+					continue
+				}
+				var dj float64 = 0
+				for a := 0; a < d; a++ {
+					diff := X[i*d+a] - X[j*d+a]
+					dj += diff * diff
+				}
+				c := len(nbr[i])
+				if c == k {
+					if k == 0 || dj >= dist[k-1] {
+						continue
+					}
+					c = k - 1
+				} else {
+					nbr[i] = append(nbr[i], 0)
+				}
+				for c > 0 && dist[c-1] > dj {
+					dist[c] = dist[c-1]
+					nbr[i][c] = nbr[i][c-1]
+					c--
+				}
+				dist[c] = dj
+				nbr[i][c] = j
+			}
+			cond[i] = make([]float64, k)
+			// Binary search for the precision that gives the requested entropy
+			beta, lo_beta, hi_beta := 1.0, 0.0, math.Inf(1)
+			for step := 0; step < 200; step++ {
+				var sum, h float64 = 0, 0
+				for a := range nbr[i] {
+					cond[i][a] = math.Exp(-beta * (dist[a] - dist[0]))
+					sum += cond[i][a]
+				}
+				for a := range nbr[i] {
+					cond[i][a] /= sum
+					h += beta * (dist[a] - dist[0]) * cond[i][a]
+				}
+				h += math.Log(sum)
+				diff := h - math.Log(perplexity)
+				if math.Abs(diff) < 1e-5 {
+					break
+				}
+				if diff > 0 {
+					lo_beta = beta
+					if math.IsInf(hi_beta, 1) {
+						beta *= 2
+					} else {
+						beta = (beta + hi_beta) / 2
+					}
+				} else {
+					hi_beta = beta
+					beta = (beta + lo_beta) / 2
+				}
+			}
+		}
+	})
+	// Symmetrize: p_ij = (p_j|i + p_i|j) / 2n
+	sym := make([]map[int]float64, n)
+	for i := 0; i < n; i++ {
+		sym[i] = make(map[int]float64)
+	}
+	for i := 0; i < n; i++ {
+		for a, j := range nbr[i] {
+			p := cond[i][a] / float64(2*n)
+			sym[i][j] += p
+			sym[j][i] += p
+		}
+	}
+	pn := make([][]int, n)
+	pv := make([][]float64, n)
+	for i := 0; i < n; i++ {
+		for j := range sym[i] {
+			pn[i] = append(pn[i], j)
+		}
+		sort.Ints(pn[i])
+		pv[i] = make([]float64, len(pn[i]))
+		for a, j := range pn[i] {
+			pv[i][a] = sym[i][j]
+		}
+	}
+	return pn, pv
+}
+
+// Embeds the rows of X in two dimensions with Barnes-Hut t-SNE, starting from the PCA projection
+func TSNE(X []float64, n, d int) []float64 {
+	if n < 2 {
+		return make([]float64, 2*n)
+	}
+	pn, pv := InputSimilarities(X, n, d)
+	Y := PCA2(X, n, d)
+	// Scale the initial layout down so that the early iterations are not dominated by it
+	var sd float64 = 0
+	for i := 0; i < n; i++ {
+		sd += Y[2*i] * Y[2*i]
+	}
+	sd = math.Sqrt(sd / float64(n))
+	for a := range Y {
+		if sd > 0 {
+			Y[a] *= 1e-4 / sd
+		}
+	}
+	uY := make([]float64, 2*n)
+	gains := make([]float64, 2*n)
+	grad := make([]float64, 2*n)
+	for a := range gains {
+		gains[a] = 1
+	}
+	const eta float64 = 200
+	zs := make([]float64, n)
+	for it := 0; it < tsne_iter; it++ {
+		exaggeration, momentum := 1.0, 0.8
+		if it < 250 {
+			exaggeration, momentum = 12, 0.5
+		}
+		tree := BuildQuadTree(Y, n)
+		vecutil.ParallelRange(n, num_threads, func(id, lo, hi int) {
+			for i := lo; i < hi; i++ {
+				f := []float64{0, 0}
+				zs[i] = tree.Repulsion(Y, i, f)
+				grad[2*i], grad[2*i+1] = -f[0], -f[1]
+			}
+		})
+		var z float64 = 0
+		for i := 0; i < n; i++ {
+			z += zs[i]
+		}
+		vecutil.ParallelRange(n, num_threads, func(id, lo, hi int) {
+			for i := lo; i < hi; i++ {
+				var ax, ay float64 = 0, 0
+				for a, j := range pn[i] {
+					dx, dy := Y[2*i]-Y[2*j], Y[2*i+1]-Y[2*j+1]
+					w := pv[i][a] / (1 + dx*dx + dy*dy)
+					ax += w * dx
+					ay += w * dy
+				}
+				grad[2*i] = 4 * (exaggeration*ax + grad[2*i]/z)
+				grad[2*i+1] = 4 * (exaggeration*ay + grad[2*i+1]/z)
+			}
+		})
+		for a := range Y {
+			if (grad[a] > 0) != (uY[a] > 0) {
+				gains[a] += 0.2
+			} else {
+				gains[a] *= 0.8
+			}
+			if gains[a] < 0.01 {
+				gains[a] = 0.01
+			}
+			uY[a] = momentum*uY[a] - eta*gains[a]*grad[a]
+			Y[a] += uY[a]
+		}
+		// Keep the embedding centred
+		var mx, my float64 = 0, 0
+		for i := 0; i < n; i++ {
+			mx += Y[2*i]
+			my += Y[2*i+1]
+		}
+		for i := 0; i < n; i++ {
+			Y[2*i] -= mx / float64(n)
+			Y[2*i+1] -= my / float64(n)
+		}
+		if debug_mode > 1 && ((it+1)%50 == 0 || it == tsne_iter-1) {
+			fmt.Fprintf(os.Stderr, "%ct-SNE iteration %d/%d", 13, it+1, tsne_iter)
+		}
+	}
+	if debug_mode > 1 {
+		fmt.Fprintf(os.Stderr, "\n")
+	}
+	return Y
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"../vecutil"
+)
+
+var input_file, output_file, save_projection_file string
+var binaryf int = 0
+var dims int = 100
+var center int = 1
+var svd string = "auto"
+var oversample int = 10
+var power_iter int = 2
+var debug_mode int = 2
+var num_threads int = 12
+var words, size int
+var vocab []string
+var M []float64
+
+// Vocabularies larger than this use the randomized SVD with -svd auto
+const exact_svd_max_words int = 20000
+
+// Returns X^T Y for the n x d matrix X and the n x l matrix Y stored by columns, as l columns of length d
+func TransposeTimes(X, Y []float64, n, d, l int) []float64 {
+	part := make([][]float64, num_threads)
+	vecutil.ParallelRange(n, num_threads, func(id, lo, hi int) {
+		z := make([]float64, l*d)
+		for i := lo; i < hi; i++ {
+			for c := 0; c < l; c++ {
+				y := Y[c*n+i]
+				for a := 0; a < d; a++ {
+					z[c*d+a] += X[i*d+a] * y
+				}
+			}
+		}
+		part[id] = z
+	})
+	Z := make([]float64, l*d)
+	for _, z := range part {
+		for a := range z {
+			Z[a] += z[a]
+		}
+	}
+	return Z
+}
+
+// Returns X W for the n x d matrix X and the d x l matrix W stored by columns, as l columns of length n
+func Times(X, W []float64, n, d, l int) []float64 {
+	Y := make([]float64, l*n)
+	vecutil.ParallelRange(n, num_threads, func(id, lo, hi int) {
+		for i := lo; i < hi; i++ {
+			for c := 0; c < l; c++ {
+				var s float64 = 0
+				for a := 0; a < d; a++ {
+					s += X[i*d+a] * W[c*d+a]
+				}
+				Y[c*n+i] = s
+			}
+		}
+	})
+	return Y
+}
+
+// Orthonormalizes the l columns of length n of Y with modified Gram-Schmidt
+func Orthonormalize(Y []float64, n, l int) {
+	for c := 0; c < l; c++ {
+		col := Y[c*n : (c+1)*n]
+		for e := 0; e < c; e++ {
+			prev := Y[e*n : (e+1)*n]
+			var s float64 = 0
+			for i := 0; i < n; i++ {
+				s += col[i] * prev[i]
+			}
+			for i := 0; i < n; i++ {
+				col[i] -= s * prev[i]
+			}
+		}
+		var length float64 = 0
+		for i := 0; i < n; i++ {
+			length += col[i] * col[i]
+		}
+		length = math.Sqrt(length)
+		if length == 0 {
+			continue
+		}
+		for i := 0; i < n; i++ {
+			col[i] /= length
+		}
+	}
+}
+
+// Returns the variances along the first k principal components of the rows of the centred X and the
+// components as rows, from the eigen decomposition of the covariance matrix
+func ExactPCA(X []float64, n, d, k int) ([]float64, []float64) {
+	C := TransposeTimes(X, ColumnsOf(X, n, d), n, d, d)
+	for a := range C {
+		C[a] /= float64(n - 1)
+	}
+	vals, vecs := vecutil.SymmetricEigen(C, d)
+	return vals[:k], vecs[:k*d]
+}
+
+// Returns the n x d matrix X stored by columns
+func ColumnsOf(X []float64, n, d int) []float64 {
+	Y := make([]float64, d*n)
+	for i := 0; i < n; i++ {
+		for a := 0; a < d; a++ {
+			Y[a*n+i] = X[i*d+a]
+		}
+	}
+	return Y
+}
+
+// Same as ExactPCA using a randomized SVD: the range of X is sampled with k + oversample random directions
+// refined by power_iter power iterations, and the small projected problem is solved exactly
+func RandomizedPCA(X []float64, n, d, k int) ([]float64, []float64) {
+	var next_random uint64 = 1
+	l := k + oversample
+	if l > d {
+		l = d
+	}
+	if l > n {
+		l = n
+	}
+	W := make([]float64, l*d)
+	for a := range W {
+		// Sum of uniform draws as an approximately Gaussian test matrix
+		for b := 0; b < 4; b++ {
+			next_random = next_random*uint64(25214903917) + 11
+			W[a] += float64(next_random&0xFFFF)/float64(65536) - 0.5
+		}
+	}
+	Q := Times(X, W, n, d, l)
+	Orthonormalize(Q, n, l)
+	for it := 0; it < power_iter; it++ {
+		W = TransposeTimes(X, Q, n, d, l)
+		Orthonormalize(W, d, l)
+		Q = Times(X, W, n, d, l)
+		Orthonormalize(Q, n, l)
+	}
+	// B = Q^T X is l x d; the right singular vectors of B come from the eigenvectors of B B^T
+	B := TransposeTimes(X, Q, n, d, l)
+	G := make([]float64, l*l)
+	for p := 0; p < l; p++ {
+		for q := 0; q < l; q++ {
+			var s float64 = 0
+			for a := 0; a < d; a++ {
+				s += B[p*d+a] * B[q*d+a]
+			}
+			G[p*l+q] = s
+		}
+	}
+	vals, U := vecutil.SymmetricEigen(G, l)
+	comp := make([]float64, k*d)
+	variance := make([]float64, k)
+	for c := 0; c < k; c++ {
+		variance[c] = vals[c] / float64(n-1)
+		sv := math.Sqrt(math.Max(vals[c], 0))
+		if sv == 0 {
+			continue
+		}
+		for p := 0; p < l; p++ {
+			for a := 0; a < d; a++ {
+				comp[c*d+a] += U[c*l+p] * B[p*d+a] / sv
+			}
+		}
+	}
+	return variance, comp
+}
+
+func main() {
+	args := os.Args
+	if len(args) == 1 {
+		fmt.Fprintf(os.Stderr, "REDUCE VECTORS tool\n\n")
+		fmt.Fprintf(os.Stderr, "Reduces the dimensionality of word vectors with principal component analysis\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "\t-input <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> to save the reduced word vectors, in the format of the input\n")
+		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe vectors are in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-size <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tNumber of dimensions to keep; default is 100\n")
+		fmt.Fprintf(os.Stderr, "\t-center <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSubtract the mean vector before projecting; default is 1\n")
+		fmt.Fprintf(os.Stderr, "\t-svd <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tHow the components are computed: exact (eigen decomposition of the covariance matrix), randomized\n")
+		fmt.Fprintf(os.Stderr, "\t\tor auto (randomized above %d words); default is auto\n", exact_svd_max_words)
+		fmt.Fprintf(os.Stderr, "\t-oversample <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tExtra random directions of the randomized SVD; default is 10\n")
+		fmt.Fprintf(os.Stderr, "\t-power-iter <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tPower iterations of the randomized SVD; more are slower and more accurate; default is 2\n")
+		fmt.Fprintf(os.Stderr, "\t-save-projection <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSave the projection to <file> in the format of the input: the row 'mean' holds the subtracted mean\n")
+		fmt.Fprintf(os.Stderr, "\t\tand the rows 1 to size the components; a vector v maps to (v - mean) . component\n")
+		fmt.Fprintf(os.Stderr, "\t-threads <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <int> threads (default 12)\n")
+		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = explained variance of every component)\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "./reduce-vectors -input vectors300.bin -binary 1 -output vectors100.bin -size 100 -save-projection pca.bin\n\n")
+		os.Exit(0)
+	}
+	if i := vecutil.ArgPos("-input", args); i > 0 {
+		input_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-output", args); i > 0 {
+		output_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		binaryf = int(v)
+	}
+	if i := vecutil.ArgPos("-size", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		dims = int(v)
+	}
+	if i := vecutil.ArgPos("-center", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		center = int(v)
+	}
+	if i := vecutil.ArgPos("-svd", args); i > 0 {
+		svd = args[i+1]
+	}
+	if i := vecutil.ArgPos("-oversample", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		oversample = int(v)
+	}
+	if i := vecutil.ArgPos("-power-iter", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		power_iter = int(v)
+	}
+	if i := vecutil.ArgPos("-save-projection", args); i > 0 {
+		save_projection_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-threads", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		num_threads = int(v)
+		if num_threads < 1 {
+			num_threads = 1
+		}
+	}
+	if i := vecutil.ArgPos("-debug", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		debug_mode = int(v)
+	}
+	if input_file == "" || output_file == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: -input and -output are required\n")
+		os.Exit(1)
+	}
+	if svd != "auto" && svd != "exact" && svd != "randomized" {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown -svd %s\n", svd)
+		os.Exit(1)
+	}
+	m := vecutil.ReadVectors(input_file, binaryf != 0, debug_mode > 0)
+	words, size, vocab, M = m.Words, m.Size, m.Vocab, m.M
+	if dims <= 0 || dims > size || dims >= words {
+		fmt.Fprintf(os.Stderr, "ERROR: -size must be between 1 and %d, and smaller than the number of words\n", size)
+		os.Exit(1)
+	}
+	mean := make([]float64, size)
+	if center != 0 {
+		for b := 0; b < words; b++ {
+			for a := 0; a < size; a++ {
+				mean[a] += M[b*size+a] / float64(words)
+			}
+		}
+		for b := 0; b < words; b++ {
+			for a := 0; a < size; a++ {
+				M[b*size+a] -= mean[a]
+			}
+		}
+	}
+	if svd == "auto" {
+		svd = "exact"
+		if words > exact_svd_max_words {
+			svd = "randomized"
+		}
+	}
+	var variance, comp []float64
+	if svd == "exact" {
+		variance, comp = ExactPCA(M, words, size, dims)
+	} else {
+		variance, comp = RandomizedPCA(M, words, size, dims)
+	}
+	// The total variance is the sum of the variances of all dimensions
+	var total float64 = 0
+	for a := range M {
+		total += M[a] * M[a]
+	}
+	total /= float64(words - 1)
+	var kept float64 = 0
+	for c := 0; c < dims; c++ {
+		kept += variance[c]
+		if debug_mode > 1 {
+			fmt.Fprintf(os.Stderr, "Component %d: variance %f, explained %.2f%%, cumulative %.2f%%\n", c+1, variance[c],
+				variance[c]/total*100, kept/total*100)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Explained variance with %d of %d dimensions (%s SVD): %.2f%%\n", dims, size, svd, kept/total*100)
+	reduced := make([]float64, words*dims)
+	vecutil.ParallelRange(words, num_threads, func(id, lo, hi int) {
+		for b := lo; b < hi; b++ {
+			for c := 0; c < dims; c++ {
+				var s float64 = 0
+				for a := 0; a < size; a++ {
+					s += M[b*size+a] * comp[c*size+a]
+				}
+				reduced[b*dims+c] = s
+			}
+		}
+	})
+	vecutil.SaveVectors(output_file, vocab, reduced, dims, binaryf != 0)
+	if save_projection_file != "" {
+		names := []string{"mean"}
+		for c := 0; c < dims; c++ {
+			names = append(names, strconv.Itoa(c+1))
+		}
+		vecutil.SaveVectors(save_projection_file, names, append(mean, comp...), size, binaryf != 0)
+	}
+	os.Exit(0)
+}
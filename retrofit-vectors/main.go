@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"../vecutil"
+)
+
+var input_file, output_file, lexicon_file string
+var binaryf int = 0
+var iterations int = 10
+var alpha float64 = 1
+var beta float64 = 1
+var symmetric int = 1
+var normalize int = 0
+var debug_mode int = 2
+var words, size int
+var vocab []string
+var vocab_index map[string]int
+var M []float64
+
+// Reads the lexicon, one word followed by its related words per line, and returns the neighbours of every
+// word of the vocabulary; pairs with a word that is not in the vocabulary are ignored
+func ReadLexicon() [][]int {
+	f, err := os.Open(lexicon_file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: lexicon file %s not found\n", lexicon_file)
+		os.Exit(1)
+	}
+	defer f.Close()
+	edges := make([]map[int]bool, words)
+	add := func(a, b int) {
+		if a == b {
+			return
+		}
+		if edges[a] == nil {
+			edges[a] = make(map[int]bool)
+		}
+		edges[a][b] = true
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		st := strings.Fields(scanner.Text())
+		if len(st) < 2 {
+			continue
+		}
+		a, ok := vocab_index[st[0]]
+		if !ok {
+			continue
+		}
+		for _, w := range st[1:] {
+			b, ok := vocab_index[w]
+			if !ok {
+				continue
+			}
+			add(a, b)
+			if symmetric != 0 {
+				add(b, a)
+			}
+		}
+	}
+	vecutil.FailOnError(scanner.Err(), "Cannot read lexicon file")
+	nbr := make([][]int, words)
+	var connected, pairs int
+	for a := 0; a < words; a++ {
+		for b := range edges[a] {
+			nbr[a] = append(nbr[a], b)
+		}
+		// Follow the vocabulary order so that the result does not depend on map iteration
+		sort.Ints(nbr[a])
+		if len(nbr[a]) > 0 {
+			connected++
+			pairs += len(nbr[a])
+		}
+	}
+	if debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "Lexicon: %d words with neighbours, %d links\n", connected, pairs)
+	}
+	return nbr
+}
+
+// Retrofits the vectors to the lexicon graph: every word with neighbours is repeatedly moved to the weighted
+// average of its original vector, with weight alpha, and of its neighbours' current vectors, with weight
+// beta divided by its number of neighbours
+func Retrofit(nbr [][]int) {
+	orig := make([]float64, len(M))
+	copy(orig, M)
+	vec := make([]float64, size)
+	for it := 0; it < iterations; it++ {
+		var change float64 = 0
+		for a := 0; a < words; a++ {
+			if len(nbr[a]) == 0 {
+				continue
+			}
+			w := beta / float64(len(nbr[a]))
+			for c := 0; c < size; c++ {
+				vec[c] = alpha * orig[a*size+c]
+			}
+			for _, b := range nbr[a] {
+				for c := 0; c < size; c++ {
+					vec[c] += w * M[b*size+c]
+				}
+			}
+			for c := 0; c < size; c++ {
+				v := vec[c] / (alpha + beta)
+				change += (v - M[a*size+c]) * (v - M[a*size+c])
+				M[a*size+c] = v
+			}
+		}
+		if debug_mode > 1 {
+			fmt.Fprintf(os.Stderr, "Iteration %d: change %f\n", it+1, math.Sqrt(change))
+		}
+	}
+}
+
+func main() {
+	args := os.Args
+	if len(args) == 1 {
+		fmt.Fprintf(os.Stderr, "RETROFIT VECTORS tool\n\n")
+		fmt.Fprintf(os.Stderr, "Pulls the vectors of words related in a lexicon together\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "\t-input <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe vectors are in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-lexicon <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse the lexicon in <file>: every line holds a word followed by its related words\n")
+		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> to save the retrofitted word vectors, in the format of the input\n")
+		fmt.Fprintf(os.Stderr, "\t-iter <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tNumber of iterations; default is 10\n")
+		fmt.Fprintf(os.Stderr, "\t-alpha <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tWeight anchoring every word to its original vector; default is 1\n")
+		fmt.Fprintf(os.Stderr, "\t-beta <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tTotal weight of the related words of every word, shared equally among them; default is 1\n")
+		fmt.Fprintf(os.Stderr, "\t-symmetric <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tA word listed as related also gets the head word of the line as neighbour; default is 1\n")
+		fmt.Fprintf(os.Stderr, "\t-normalize <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tScale the vectors to unit length before retrofitting; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = more info during the iterations)\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "./retrofit-vectors -input vectors.bin -binary 1 -lexicon synonyms.txt -output retrofitted.bin -iter 10\n\n")
+		os.Exit(0)
+	}
+	if i := vecutil.ArgPos("-input", args); i > 0 {
+		input_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		binaryf = int(v)
+	}
+	if i := vecutil.ArgPos("-lexicon", args); i > 0 {
+		lexicon_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-output", args); i > 0 {
+		output_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-iter", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		iterations = int(v)
+	}
+	if i := vecutil.ArgPos("-alpha", args); i > 0 {
+		alpha, _ = strconv.ParseFloat(args[i+1], 64)
+	}
+	if i := vecutil.ArgPos("-beta", args); i > 0 {
+		beta, _ = strconv.ParseFloat(args[i+1], 64)
+	}
+	if i := vecutil.ArgPos("-symmetric", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		symmetric = int(v)
+	}
+	if i := vecutil.ArgPos("-normalize", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		normalize = int(v)
+	}
+	if i := vecutil.ArgPos("-debug", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		debug_mode = int(v)
+	}
+	if input_file == "" || output_file == "" || lexicon_file == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: -input, -lexicon and -output are required\n")
+		os.Exit(1)
+	}
+	if alpha < 0 || beta < 0 || alpha+beta == 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: -alpha and -beta must not be negative, and one of them must be positive\n")
+		os.Exit(1)
+	}
+	m := vecutil.ReadVectors(input_file, binaryf != 0, debug_mode > 0)
+	if normalize != 0 {
+		m.Normalize()
+	}
+	words, size, vocab, vocab_index, M = m.Words, m.Size, m.Vocab, m.Index, m.M
+	Retrofit(ReadLexicon())
+	vecutil.SaveVectors(output_file, vocab, M, size, binaryf != 0)
+	os.Exit(0)
+}
@@ -0,0 +1,95 @@
+package vecutil
+
+import "math"
+
+// Returns the orthogonal d x d matrix W minimizing the distance between x W and y over the pairs of rows
+// (orthogonal Procrustes): with A = X^T Y = U S V^T, W = U V^T = A (A^T A)^(-1/2)
+func Procrustes(src, tgt *Model, pairs [][2]int) []float64 {
+	d := src.Size
+	A := make([]float64, d*d)
+	for _, p := range pairs {
+		x := src.M[p[0]*d : (p[0]+1)*d]
+		y := tgt.M[p[1]*d : (p[1]+1)*d]
+		for i := 0; i < d; i++ {
+			for j := 0; j < d; j++ {
+				A[i*d+j] += x[i] * y[j]
+			}
+		}
+	}
+	AtA := make([]float64, d*d)
+	for i := 0; i < d; i++ {
+		for j := 0; j < d; j++ {
+			var s float64 = 0
+			for k := 0; k < d; k++ {
+				s += A[k*d+i] * A[k*d+j]
+			}
+			AtA[i*d+j] = s
+		}
+	}
+	vals, vecs := SymmetricEigen(AtA, d)
+	// R = (A^T A)^(-1/2), ignoring the directions the pairs do not constrain
+	R := make([]float64, d*d)
+	for c := 0; c < d; c++ {
+		if vals[c] <= 1e-12*vals[0] {
+			continue
+		}
+		s := 1 / math.Sqrt(vals[c])
+		for i := 0; i < d; i++ {
+			for j := 0; j < d; j++ {
+				R[i*d+j] += vecs[c*d+i] * s * vecs[c*d+j]
+			}
+		}
+	}
+	W := make([]float64, d*d)
+	for i := 0; i < d; i++ {
+		for j := 0; j < d; j++ {
+			var s float64 = 0
+			for k := 0; k < d; k++ {
+				s += A[i*d+k] * R[k*d+j]
+			}
+			W[i*d+j] = s
+		}
+	}
+	return W
+}
+
+// Returns, for every query row of q, the k rows of m among the first n with the highest cosine similarity;
+// the rows are expected to have unit length
+func NearestNeighbours(q *Model, queries []int, m *Model, n, k, threads int) [][]int {
+	d := m.Size
+	if n > m.Words {
+		n = m.Words
+	}
+	if k > n {
+		k = n
+	}
+	res := make([][]int, len(queries))
+	ParallelRange(len(queries), threads, func(id, lo, hi int) {
+		bestd := make([]float64, k)
+		for a := lo; a < hi; a++ {
+			x := q.M[queries[a]*d : (queries[a]+1)*d]
+			best := make([]int, k)
+			for c := 0; c < k; c++ {
+				bestd[c] = -2
+				best[c] = -1
+			}
+			for b := 0; b < n; b++ {
+				var dist float64 = 0
+				for i := 0; i < d; i++ {
+					dist += x[i] * m.M[b*d+i]
+				}
+				for c := 0; c < k; c++ {
+					if dist > bestd[c] {
+						copy(bestd[c+1:], bestd[c:k-1])
+						copy(best[c+1:], best[c:k-1])
+						bestd[c] = dist
+						best[c] = b
+						break
+					}
+				}
+			}
+			res[a] = best
+		}
+	})
+	return res
+}
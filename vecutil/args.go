@@ -0,0 +1,29 @@
+package vecutil
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// Returns the position of the option str in args, or -1 if it is not given
+func ArgPos(str string, args []string) int {
+	var a int
+	for a = 1; a < len(args); a++ {
+		if str == args[a] {
+			if a == len(args)-1 {
+				fmt.Fprintf(os.Stderr, "Argument missing for %s\n", str)
+				os.Exit(1)
+			}
+			return a
+		}
+	}
+	return -1
+}
+
+// Exits with msg when err is not nil
+func FailOnError(err error, msg string) {
+	if err != nil {
+		log.Fatalf("%s: %s", msg, err)
+	}
+}
@@ -0,0 +1,70 @@
+package vecutil
+
+import (
+	"math"
+	"sort"
+)
+
+// Returns the eigenvalues of the symmetric m x m matrix A in decreasing order and the matching unit
+// eigenvectors as rows, using cyclic Jacobi rotations; A is destroyed
+func SymmetricEigen(A []float64, m int) ([]float64, []float64) {
+	V := make([]float64, m*m)
+	for a := 0; a < m; a++ {
+		V[a*m+a] = 1
+	}
+	for sweep := 0; sweep < 100; sweep++ {
+		var off float64 = 0
+		for p := 0; p < m; p++ {
+			for q := p + 1; q < m; q++ {
+				off += A[p*m+q] * A[p*m+q]
+			}
+		}
+		if off < 1e-22 {
+			break
+		}
+		for p := 0; p < m; p++ {
+			for q := p + 1; q < m; q++ {
+				if A[p*m+q] == 0 {
+					continue
+				}
+				t := (A[q*m+q] - A[p*m+p]) / (2 * A[p*m+q])
+				if t >= 0 {
+					t = 1 / (t + math.Sqrt(1+t*t))
+				} else {
+					t = -1 / (-t + math.Sqrt(1+t*t))
+				}
+				c := 1 / math.Sqrt(1+t*t)
+				s := t * c
+				for k := 0; k < m; k++ {
+					akp, akq := A[k*m+p], A[k*m+q]
+					A[k*m+p] = c*akp - s*akq
+					A[k*m+q] = s*akp + c*akq
+				}
+				for k := 0; k < m; k++ {
+					apk, aqk := A[p*m+k], A[q*m+k]
+					A[p*m+k] = c*apk - s*aqk
+					A[q*m+k] = s*apk + c*aqk
+				}
+				for k := 0; k < m; k++ {
+					vkp, vkq := V[k*m+p], V[k*m+q]
+					V[k*m+p] = c*vkp - s*vkq
+					V[k*m+q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+	order := make([]int, m)
+	for a := range order {
+		order[a] = a
+	}
+	sort.SliceStable(order, func(i, j int) bool { return A[order[i]*m+order[i]] > A[order[j]*m+order[j]] })
+	vals := make([]float64, m)
+	vecs := make([]float64, m*m)
+	for a, o := range order {
+		vals[a] = A[o*m+o]
+		for k := 0; k < m; k++ {
+			vecs[a*m+k] = V[k*m+o]
+		}
+	}
+	return vals, vecs
+}
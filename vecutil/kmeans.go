@@ -0,0 +1,170 @@
+package vecutil
+
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
+// Returns the reciprocal length of every row of vec, 0 for zero rows
+func InverseNorms(vec []float64, n, size int) []float64 {
+	inv := make([]float64, n)
+	for a := 0; a < n; a++ {
+		var length float64 = 0
+		for b := 0; b < size; b++ {
+			length += vec[a*size+b] * vec[a*size+b]
+		}
+		if length > 0 {
+			inv[a] = 1 / math.Sqrt(length)
+		}
+	}
+	return inv
+}
+
+// Chooses the initial centroids with k-means++ seeding using cosine distance
+func KMeansPlusPlus(vec, inv []float64, n, size, k, threads int, next_random *uint64) []float64 {
+	cent := make([]float64, k*size)
+	mind := make([]float64, n)
+	for a := 0; a < n; a++ {
+		mind[a] = math.MaxFloat64
+	}
+	*next_random = *next_random*uint64(25214903917) + 11
+	c := int((*next_random >> 16) % uint64(n))
+	for d := 0; d < k; d++ {
+		for b := 0; b < size; b++ {
+			cent[d*size+b] = vec[c*size+b] * inv[c]
+		}
+		if d == k-1 {
+			break
+		}
+		// Update the distance of every word to its closest centroid chosen so far
+		l := cent[d*size : (d+1)*size]
+		ParallelRange(n, threads, func(id, lo, hi int) {
+			for a := lo; a < hi; a++ {
+				var x float64 = 0
+				for b := 0; b < size; b++ {
+					x += l[b] * vec[a*size+b]
+				}
+				x = 1 - x*inv[a]
+				if x < 0 {
+					x = 0
+				}
+				if x < mind[a] {
+					mind[a] = x
+				}
+			}
+		})
+		// Draw the next centroid with probability proportional to the squared distance
+		var sum float64 = 0
+		for a := 0; a < n; a++ {
+			sum += mind[a] * mind[a]
+		}
+		*next_random = *next_random*uint64(25214903917) + 11
+		if sum == 0 {
+			c = int((*next_random >> 16) % uint64(n))
+			continue
+		}
+		r := float64(*next_random&0xFFFFFF) / float64(0x1000000) * sum
+		for c = 0; c < n-1; c++ {
+			r -= mind[c] * mind[c]
+			if r < 0 {
+				break
+			}
+		}
+	}
+	return cent
+}
+
+// Assigns every word to its closest centroid in parallel and returns the number of words that changed class
+func KMeansAssign(vec, inv, cent []float64, cl []int, dist []float64, n, size, k, threads int) int {
+	if threads < 1 {
+		threads = 1
+	}
+	changed := make([]int, threads)
+	ParallelRange(n, threads, func(id, lo, hi int) {
+		for c := lo; c < hi; c++ {
+			var closev float64 = -10
+			var closeid int = 0
+			for d := 0; d < k; d++ {
+				var x float64 = 0
+				for b := 0; b < size; b++ {
+					x += cent[size*d+b] * vec[c*size+b]
+				}
+				if x > closev {
+					closev = x
+					closeid = d
+				}
+			}
+			if cl[c] != closeid {
+				cl[c] = closeid
+				changed[id]++
+			}
+			dist[c] = 1 - closev*inv[c]
+		}
+	})
+	total := 0
+	for _, v := range changed {
+		total += v
+	}
+	return total
+}
+
+// Recomputes the normalized centroids from the current assignment; empty classes keep their old centroid
+func KMeansUpdate(vec, cent []float64, cl, centcn []int, n, size, k int) {
+	sum := make([]float64, k*size)
+	for b := 0; b < k; b++ {
+		centcn[b] = 0
+	}
+	for c := 0; c < n; c++ {
+		for d := 0; d < size; d++ {
+			sum[size*cl[c]+d] += vec[c*size+d]
+		}
+		centcn[cl[c]]++
+	}
+	for b := 0; b < k; b++ {
+		if centcn[b] == 0 {
+			continue
+		}
+		var closev float64 = 0
+		for c := 0; c < size; c++ {
+			closev += sum[size*b+c] * sum[size*b+c]
+		}
+		closev = math.Sqrt(closev)
+		if closev == 0 {
+			continue
+		}
+		for c := 0; c < size; c++ {
+			cent[size*b+c] = sum[size*b+c] / closev
+		}
+	}
+}
+
+// Runs K-means on the rows of vec using cosine similarity, printing the progress with debug
+// Returns the class of every row, the unit-length centroids, the cosine distance of every row to its centroid and the class sizes
+func KMeans(vec []float64, n, size, k, max_iter int, tol float64, threads int, debug bool) (cl []int, cent []float64, dist []float64, centcn []int) {
+	var next_random uint64 = 1
+	if k > n {
+		k = n
+	}
+	cl = make([]int, n)
+	dist = make([]float64, n)
+	centcn = make([]int, k)
+	inv := InverseNorms(vec, n, size)
+	cent = KMeansPlusPlus(vec, inv, n, size, k, threads, &next_random)
+	for a := 0; a < n; a++ {
+		cl[a] = -1
+	}
+	for a := 0; a < max_iter; a++ {
+		changed := KMeansAssign(vec, inv, cent, cl, dist, n, size, k, threads)
+		KMeansUpdate(vec, cent, cl, centcn, n, size, k)
+		if debug {
+			fmt.Fprintf(os.Stderr, "K-means iteration %d: %d words changed class\n", a+1, changed)
+		}
+		if float64(changed) <= tol*float64(n) {
+			break
+		}
+	}
+	KMeansAssign(vec, inv, cent, cl, dist, n, size, k, threads)
+	KMeansUpdate(vec, cent, cl, centcn, n, size, k)
+	return
+}
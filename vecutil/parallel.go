@@ -0,0 +1,23 @@
+package vecutil
+
+import "sync"
+
+// Splits [0, n) into at most threads contiguous ranges and runs fn on each of them in parallel; id is
+// below threads, so per-thread partial results can be kept in a slice of threads entries
+func ParallelRange(n, threads int, fn func(id, lo, hi int)) {
+	var wg sync.WaitGroup
+	if threads < 1 {
+		threads = 1
+	}
+	if threads > n {
+		threads = n
+	}
+	for t := 0; t < threads; t++ {
+		wg.Add(1)
+		go func(t int) {
+			defer wg.Done()
+			fn(t, n*t/threads, n*(t+1)/threads)
+		}(t)
+	}
+	wg.Wait()
+}
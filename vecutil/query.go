@@ -0,0 +1,108 @@
+package vecutil
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A word of a query with its position in the vocabulary and its signed weight
+type QueryTerm struct {
+	Word   string
+	Index  int
+	Weight float64
+}
+
+// Returns the position of word in vocab, or -1 if it is not there
+func SearchVocab(vocab []string, word string) int {
+	for b := 0; b < len(vocab); b++ {
+		if vocab[b] == word {
+			return b
+		}
+	}
+	return -1
+}
+
+// Parses a query of words joined by + and -, each optionally weighted as in 0.5*italy, for example
+// "paris - france + 0.5*italy"; the operators are separated by spaces, and words without an operator
+// between them are added
+func ParseQuery(line string, vocab []string) ([]QueryTerm, error) {
+	var terms []QueryTerm
+	var sign float64 = 1
+	op := ""
+	for _, tok := range strings.Fields(line) {
+		if tok == "+" || tok == "-" {
+			if op != "" {
+				return nil, fmt.Errorf("operator %s follows operator %s", tok, op)
+			}
+			op = tok
+			sign = 1
+			if tok == "-" {
+				sign = -1
+			}
+			continue
+		}
+		var weight float64 = 1
+		word := tok
+		if i := strings.Index(tok, "*"); i >= 0 && SearchVocab(vocab, tok) == -1 {
+			w, err := strconv.ParseFloat(tok[:i], 64)
+			if err != nil || math.IsNaN(w) || math.IsInf(w, 0) {
+				return nil, fmt.Errorf("invalid weight %q in term %q", tok[:i], tok)
+			}
+			weight = w
+			word = tok[i+1:]
+			if word == "" {
+				return nil, fmt.Errorf("missing word after weight in term %q", tok)
+			}
+		}
+		index := SearchVocab(vocab, word)
+		if index == -1 {
+			return nil, fmt.Errorf("out of dictionary word %q", word)
+		}
+		terms = append(terms, QueryTerm{word, index, sign * weight})
+		sign = 1
+		op = ""
+	}
+	if op != "" {
+		return nil, fmt.Errorf("missing word after operator %s", op)
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+	return terms, nil
+}
+
+// Stores the unit-length weighted sum of the vectors of terms in vec
+func QueryVector(terms []QueryTerm, M, vec []float64, size int) error {
+	for a := 0; a < size; a++ {
+		vec[a] = 0
+	}
+	for _, t := range terms {
+		for a := 0; a < size; a++ {
+			vec[a] += t.Weight * M[a+t.Index*size]
+		}
+	}
+	var length float64 = 0
+	for a := 0; a < size; a++ {
+		length += vec[a] * vec[a]
+	}
+	if length == 0 {
+		return fmt.Errorf("the query vector is zero")
+	}
+	length = math.Sqrt(length)
+	for a := 0; a < size; a++ {
+		vec[a] /= length
+	}
+	return nil
+}
+
+// Returns whether the query words st contain a + or - operator
+func HasOperator(st []string) bool {
+	for _, tok := range st {
+		if tok == "+" || tok == "-" {
+			return true
+		}
+	}
+	return false
+}
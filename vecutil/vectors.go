@@ -0,0 +1,116 @@
+// Package vecutil holds the code shared by the word vector tools: reading and writing vectors, parallel
+// loops over rows, k-means and the linear algebra of the projection and alignment tools
+package vecutil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Word vectors as read from a file in the word2vec format; the rows of M follow Vocab
+type Model struct {
+	Words, Size int
+	Vocab       []string
+	Index       map[string]int // Position of every word in Vocab
+	M           []float64
+}
+
+// Reads word vectors in the text or binary format written by word2vec; with debug the dimensions are printed
+func ReadVectors(file string, binaryf bool, debug bool) *Model {
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Input file %s not found\n", file)
+		os.Exit(-1)
+	}
+	defer f.Close()
+	m := &Model{}
+	br := bufio.NewReader(f)
+	fmt.Fscanf(br, "%d", &m.Words)
+	fmt.Fscanf(br, "%d", &m.Size)
+	if debug {
+		fmt.Fprintf(os.Stderr, "%s: words: %d size: %d\n", file, m.Words, m.Size)
+	}
+	m.Vocab = make([]string, m.Words)
+	m.Index = make(map[string]int, m.Words)
+	m.M = make([]float64, m.Words*m.Size)
+	for b := 0; b < m.Words; b++ {
+		if binaryf {
+			m.Vocab[b], err = br.ReadString(' ')
+			FailOnError(err, "Cannot read input file")
+			m.Vocab[b] = strings.TrimSpace(m.Vocab[b])
+			err = binary.Read(br, binary.LittleEndian, m.M[b*m.Size:b*m.Size+m.Size])
+			FailOnError(err, "Cannot read input file")
+		} else {
+			line, err := br.ReadString('\n')
+			if err != nil && (err != io.EOF || line == "") {
+				FailOnError(err, "Cannot read input file")
+			}
+			st := strings.Fields(line)
+			if len(st) == 0 {
+				b--
+				continue
+			}
+			if len(st) != m.Size+1 {
+				fmt.Fprintf(os.Stderr, "ERROR: line for word %s has %d values, expected %d\n", st[0], len(st)-1, m.Size)
+				os.Exit(1)
+			}
+			m.Vocab[b] = st[0]
+			for a := 0; a < m.Size; a++ {
+				m.M[b*m.Size+a], err = strconv.ParseFloat(st[a+1], 64)
+				FailOnError(err, "Cannot read input file")
+			}
+		}
+		m.Index[m.Vocab[b]] = b
+	}
+	return m
+}
+
+// Scales every vector of m to unit length
+func (m *Model) Normalize() {
+	for b := 0; b < m.Words; b++ {
+		var length float64 = 0
+		for a := 0; a < m.Size; a++ {
+			length += m.M[b*m.Size+a] * m.M[b*m.Size+a]
+		}
+		length = math.Sqrt(length)
+		if length == 0 {
+			continue
+		}
+		for a := 0; a < m.Size; a++ {
+			m.M[b*m.Size+a] /= length
+		}
+	}
+}
+
+// Saves the rows of vec, cols values each, named by names to file in the word2vec format
+func SaveVectors(file string, names []string, vec []float64, cols int, binaryf bool) {
+	f, err := os.Create(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", file)
+		os.Exit(1)
+	}
+	defer f.Close()
+	fo := bufio.NewWriter(f)
+	fmt.Fprintf(fo, "%d %d\n", len(names), cols)
+	for a := range names {
+		fmt.Fprintf(fo, "%s ", names[a])
+		if binaryf {
+			binary.Write(fo, binary.LittleEndian, vec[a*cols:(a+1)*cols])
+		} else {
+			for b := 0; b < cols; b++ {
+				fmt.Fprintf(fo, "%f ", vec[a*cols+b])
+			}
+		}
+		fmt.Fprintf(fo, "\n")
+	}
+	if err := fo.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot write %s: %v\n", file, err)
+		os.Exit(1)
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"bufio"
 	"encoding/binary"
 	"fmt"
-	"log"
 	"math"
 	"os"
 	"strings"
+
+	"../vecutil"
 )
 
 const max_size int = 2000 // max length of strings
@@ -22,8 +23,7 @@ func main() {
 	var dist, length float64
 	var bestd []float64 = make([]float64, N)
 	var vec []float64 = make([]float64, max_size)
-	var words, size, a, b, c, d, cn int
-	var bi []int = make([]int, 100)
+	var words, size, a, b, c, d int
 	if len(args) < 2 {
 		fmt.Fprintf(os.Stderr, "Usage: ./word-analogy <FILE>\nwhere FILE contains word projections in the BINARY FORMAT\n")
 		os.Exit(0)
@@ -47,7 +47,7 @@ func main() {
 		vocab[b] = vocab[b][:len(vocab[b])-1]
 		vocab[b] = strings.Replace(vocab[b], "\n", "", -1)
 		err = binary.Read(br, binary.LittleEndian, M[b*size:b*size+size])
-		failOnError(err, "Cannot read input file")
+		vecutil.FailOnError(err, "Cannot read input file")
 		length = 0
 		for a = 0; a < size; a++ {
 			length += M[a+b*size] * M[a+b*size]
@@ -65,7 +65,7 @@ func main() {
 		for a = 0; a < N; a++ {
 			bestw[a] = ""
 		}
-		fmt.Printf("Enter three words (EXIT to break): ")
+		fmt.Printf("Enter three words or an expression (EXIT to break): ")
 		sf := scanner.Scan()
 		if !sf {
 			break
@@ -74,45 +74,29 @@ func main() {
 		if st1 == "EXIT" {
 			break
 		}
-		b = 0
-		c = 0
-		st = strings.Split(st1, " ")
-		cn = len(st)
-		if cn < 3 {
-			fmt.Printf("Only %d words were entered.. three words are needed at the input to perform the calculation\n", cn)
-			continue
-		}
-		for a := 0; a < cn; a++ {
-			for b = 0; b < words; b++ {
-				if vocab[b] == st[a] {
-					break
-				}
-			}
-			if b == words {
-				b = 0
-			}
-			bi[a] = b
-			fmt.Printf("\nWord: %s  Position in vocabulary: %d\n", st[a], bi[a])
-			if b == 0 {
-				fmt.Printf("Out of dictionary word!\n")
-				break
+		// Words without operators keep the classic form: the second minus the first plus the third; as before,
+		// words after the third are ignored
+		st = strings.Fields(st1)
+		if !vecutil.HasOperator(st) {
+			if len(st) < 3 {
+				fmt.Printf("Only %d words were entered.. three words or an expression are needed at the input to perform the calculation\n", len(st))
+				continue
 			}
+			st1 = st[1] + " - " + st[0] + " + " + st[2]
 		}
-		if b == 0 {
+		terms, err := vecutil.ParseQuery(st1, vocab)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
 			continue
 		}
-		fmt.Printf("\n                                              Word              Distance\n------------------------------------------------------------------------\n")
-		for a = 0; a < size; a++ {
-			vec[a] = M[a+bi[1]*size] - M[a+bi[0]*size] + M[a+bi[2]*size]
+		for _, t := range terms {
+			fmt.Printf("\nWord: %s  Weight: %g  Position in vocabulary: %d\n", t.Word, t.Weight, t.Index)
 		}
-		length = 0
-		for a = 0; a < size; a++ {
-			length += vec[a] * vec[a]
-		}
-		length = math.Sqrt(length)
-		for a = 0; a < size; a++ {
-			vec[a] /= length
+		if err := vecutil.QueryVector(terms, M, vec, size); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			continue
 		}
+		fmt.Printf("\n                                              Word              Distance\n------------------------------------------------------------------------\n")
 		for a = 0; a < N; a++ {
 			bestd[a] = 0
 		}
@@ -120,18 +104,10 @@ func main() {
 			bestw[a] = ""
 		}
 		for c = 0; c < words; c++ {
-			if c == bi[0] {
-				continue
-			}
-			if c == bi[1] {
-				continue
-			}
-			if c == bi[2] {
-				continue
-			}
+			// Skip the words of the query
 			a = 0
-			for b := 0; b < cn; b++ {
-				if bi[b] == c {
+			for _, t := range terms {
+				if t.Index == c {
 					a = 1
 				}
 			}
@@ -160,10 +136,3 @@ func main() {
 	}
 	os.Exit(0)
 }
-
-func failOnError(err error, msg string) {
-	if err != nil {
-		log.Fatalf("%s: %s", msg, err)
-		panic(fmt.Sprintf("%s: %s", msg, err))
-	}
-}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+
+	"../vecutil"
+)
+
+var input_file, output_file string
+var save_centroids_file, save_class_sizes_file string
+var binaryf int = 0
+var debug_mode int = 2
+var num_threads int = 12
+var classes int = 100
+var classes_iter int = 10
+var classes_tol float64 = 0
+var classes_dist int = 0
+var words, size int
+var vocab []string
+var M []float64
+
+// Runs K-means on the vectors and writes the classes, and optionally the centroids and class sizes
+func SaveClasses() {
+	cl, cent, dist, centcn := vecutil.KMeans(M, words, size, classes, classes_iter, classes_tol, num_threads, debug_mode > 0)
+	f, err := os.Create(output_file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", output_file)
+		os.Exit(1)
+	}
+	defer f.Close()
+	fo := bufio.NewWriter(f)
+	for a := 0; a < words; a++ {
+		if classes_dist != 0 {
+			fmt.Fprintf(fo, "%s %d %f\n", vocab[a], cl[a], dist[a])
+		} else {
+			fmt.Fprintf(fo, "%s %d\n", vocab[a], cl[a])
+		}
+	}
+	fo.Flush()
+	if save_centroids_file != "" {
+		f, err := os.Create(save_centroids_file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", save_centroids_file)
+			os.Exit(1)
+		}
+		defer f.Close()
+		fc := bufio.NewWriter(f)
+		fmt.Fprintf(fc, "%d %d\n", len(centcn), size)
+		for a := 0; a < len(centcn); a++ {
+			fmt.Fprintf(fc, "%d ", a)
+			if binaryf != 0 {
+				binary.Write(fc, binary.LittleEndian, cent[a*size:(a+1)*size])
+			} else {
+				for b := 0; b < size; b++ {
+					fmt.Fprintf(fc, "%f ", cent[a*size+b])
+				}
+			}
+			fmt.Fprintf(fc, "\n")
+		}
+		fc.Flush()
+	}
+	if save_class_sizes_file != "" {
+		f, err := os.Create(save_class_sizes_file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", save_class_sizes_file)
+			os.Exit(1)
+		}
+		defer f.Close()
+		fs := bufio.NewWriter(f)
+		for a := 0; a < len(centcn); a++ {
+			fmt.Fprintf(fs, "%d %d\n", a, centcn[a])
+		}
+		fs.Flush()
+	}
+}
+
+func main() {
+	args := os.Args
+	if len(args) == 1 {
+		fmt.Fprintf(os.Stderr, "WORD CLASSES tool\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "\t-input <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse word vectors from <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> to save the resulting word classes\n")
+		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe vectors (and centroids) are in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-classes <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tNumber of classes; default is 100\n")
+		fmt.Fprintf(os.Stderr, "\t-iter <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tMaximum number of K-means iterations; default is 10\n")
+		fmt.Fprintf(os.Stderr, "\t-tol <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tStop when at most this fraction of words changed class; default is 0 (stop when stable)\n")
+		fmt.Fprintf(os.Stderr, "\t-dist <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tAlso write the cosine distance of each word to its class centroid; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-save-centroids <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe centroids will be saved to <file> in the word vector format\n")
+		fmt.Fprintf(os.Stderr, "\t-save-class-sizes <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe number of words in each class will be saved to <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-threads <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <int> threads (default 12)\n")
+		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = more info during clustering)\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "./word-classes -input vectors.bin -binary 1 -output classes.txt -classes 500 -iter 20 -save-class-sizes sizes.txt\n\n")
+		os.Exit(0)
+	}
+	if i := vecutil.ArgPos("-input", args); i > 0 {
+		input_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-output", args); i > 0 {
+		output_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		binaryf = int(v)
+	}
+	if i := vecutil.ArgPos("-classes", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		classes = int(v)
+	}
+	if i := vecutil.ArgPos("-iter", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		classes_iter = int(v)
+	}
+	if i := vecutil.ArgPos("-tol", args); i > 0 {
+		classes_tol, _ = strconv.ParseFloat(args[i+1], 64)
+	}
+	if i := vecutil.ArgPos("-dist", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		classes_dist = int(v)
+	}
+	if i := vecutil.ArgPos("-save-centroids", args); i > 0 {
+		save_centroids_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-save-class-sizes", args); i > 0 {
+		save_class_sizes_file = args[i+1]
+	}
+	if i := vecutil.ArgPos("-threads", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		num_threads = int(v)
+		if num_threads < 1 {
+			num_threads = 1
+		}
+	}
+	if i := vecutil.ArgPos("-debug", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		debug_mode = int(v)
+	}
+	if input_file == "" || output_file == "" || classes <= 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: -input, -output and a positive -classes are required\n")
+		os.Exit(1)
+	}
+	m := vecutil.ReadVectors(input_file, binaryf != 0, debug_mode > 0)
+	words, size, vocab, M = m.Words, m.Size, m.Vocab, m.M
+	if words == 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: no word vectors in %s\n", input_file)
+		os.Exit(1)
+	}
+	SaveClasses()
+	os.Exit(0)
+}
@@ -12,7 +12,8 @@ import (
 
 const MAX_STRING int = 60
 
-const vocab_hash_size int = 500000000 // Maximum 500M entries in the vocabulary
+const vocab_hash_min_size int = 1024    // The hash table starts with this many slots and doubles when 70% full
+const vocab_reduce_size int = 350000000 // Infrequent entries are pruned when the vocabulary grows beyond 350M entries
 
 //type real float64 // Precision of float numbers
 
@@ -42,6 +43,7 @@ var vocab vocab_slice
 var debug_mode int = 2
 var min_count int = 5
 var vocab_hash []int
+var vocab_hash_size int = 0
 var min_reduce int = 1
 var vocab_max_size int = 10000
 var vocab_size int = 0
@@ -87,14 +89,16 @@ func ReadWord(fin *bufio.Reader) (word string, err error) {
 	return
 }
 
-// Returns hash value of a word
+// Returns hash value of a word; FNV-1a mixes every byte into the low bits, which the power of two table
+// size needs, so that words sharing a prefix do not crowd into neighbouring slots
 func GetWordHash(word string) uint {
-	var hash uint = 1
+	var hash uint64 = 14695981039346656037
 	for a := 0; a < len(word); a++ {
-		hash = hash*257 + uint(word[a])
+		hash ^= uint64(word[a])
+		hash *= 1099511628211
 	}
-	hash = hash % uint(vocab_hash_size)
-	return hash
+	hash ^= hash >> 32
+	return uint(hash % uint64(vocab_hash_size))
 }
 
 // Returns position of a word in the vocabulary; if the word is not found, returns -1
@@ -109,7 +113,32 @@ func SearchVocab(word string) int {
 		}
 		hash = (hash + 1) % uint(vocab_hash_size)
 	}
-	return -1
+}
+
+// Allocates an empty hash table large enough for n entries
+func InitVocabHash(n int) {
+	size := vocab_hash_min_size
+	for float64(n) > float64(size)*0.7 {
+		size *= 2
+	}
+	vocab_hash_size = size
+	vocab_hash = make([]int, vocab_hash_size)
+	for a := 0; a < vocab_hash_size; a++ {
+		vocab_hash[a] = -1
+	}
+}
+
+// Rebuilds the hash table for the first vocab_size entries, resizing it to fit
+func RehashVocab() {
+	var hash uint
+	InitVocabHash(vocab_size)
+	for a := 0; a < vocab_size; a++ {
+		hash = GetWordHash(vocab[a].word)
+		for vocab_hash[hash] != -1 {
+			hash = (hash + 1) % uint(vocab_hash_size)
+		}
+		vocab_hash[hash] = a
+	}
 }
 
 // Reads a word and returns its index in the vocabulary
@@ -134,8 +163,13 @@ func AddWordToVocab(word string) int {
 	vocab_size++
 	// Reallocate memory if needed
 	if vocab_size+2 >= vocab_max_size {
-		vocab_max_size += 10000
-		vocab = append(vocab, make([]vocab_word, 10000)...)
+		vocab = append(vocab, make([]vocab_word, vocab_max_size)...)
+		vocab_max_size *= 2
+	}
+	// Grow the hash table when it is 70% full
+	if float64(vocab_size) > float64(vocab_hash_size)*0.7 {
+		RehashVocab()
+		return vocab_size - 1
 	}
 	hash = GetWordHash(word)
 	for vocab_hash[hash] != -1 {
@@ -148,33 +182,26 @@ func AddWordToVocab(word string) int {
 // Sorts the vocabulary by frequency using word counts
 func SortVocab() {
 	fmt.Fprintln(os.Stderr, "SortVocab")
-	var hash uint
+	var b int = 0
 	// Sort the vocabulary and keep </s> at the first position
-	sort.Sort(vocab[1:])
-	for a := 0; a < vocab_hash_size; a++ {
-		vocab_hash[a] = -1
-	}
+	sort.Sort(vocab[1:vocab_size])
 	for a := 0; a < vocab_size; a++ {
 		// Words occuring less than min_count times will be discarded from the vocab
-		if vocab[a].cn < min_count {
-			vocab_size--
-		} else {
-			// Hash will be re-computed, as after the sorting it is not actual
-			hash = GetWordHash(vocab[a].word)
-			for vocab_hash[hash] != -1 {
-				hash = (hash + 1) % uint(vocab_hash_size)
-			}
-			vocab_hash[hash] = a
+		if vocab[a].cn >= min_count {
+			vocab[b] = vocab[a]
+			b++
 		}
 	}
+	vocab_size = b
 	vocab = vocab[:vocab_size]
+	// Hash will be re-computed, as after the sorting it is not actual
+	RehashVocab()
 }
 
 // Reduces the vocabulary by removing infrequent tokens
 func ReduceVocab() {
 	fmt.Fprintln(os.Stderr, "ReduceVocab")
 	var b int = 0
-	var hash uint
 	for a := 0; a < vocab_size; a++ {
 		if vocab[a].cn > min_reduce {
 			vocab[b].cn = vocab[a].cn
@@ -185,17 +212,8 @@ func ReduceVocab() {
 		}
 	}
 	vocab_size = b
-	for a := 0; a < vocab_hash_size; a++ {
-		vocab_hash[a] = -1
-	}
-	for a := 0; a < vocab_size; a++ {
-		// Hash will be re-computed, as it is not actual
-		hash = GetWordHash(vocab[a].word)
-		for vocab_hash[hash] != -1 {
-			hash = (hash + 1) % uint(vocab_hash_size)
-		}
-		vocab_hash[hash] = a
-	}
+	// Hash will be re-computed, as it is not actual
+	RehashVocab()
 	//  fflush(stdout);
 	min_reduce++
 }
@@ -206,9 +224,7 @@ func LearnVocabFromTrainFile() {
 	var fin *bufio.Reader
 	var i int
 	var start int = 1
-	for a := 0; a < vocab_hash_size; a++ {
-		vocab_hash[a] = -1
-	}
+	InitVocabHash(0)
 	f, err := os.Open(train_file)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: training data file not found!\n")
@@ -253,7 +269,7 @@ func LearnVocabFromTrainFile() {
 		} else {
 			vocab[i].cn++
 		}
-		if float64(vocab_size) > float64(vocab_hash_size)*0.7 {
+		if vocab_size > vocab_reduce_size {
 			ReduceVocab()
 		}
 	}
@@ -390,7 +406,6 @@ func main() {
 		threshold, _ = strconv.ParseFloat(args[i+1], 64)
 	}
 	vocab = make([]vocab_word, vocab_max_size)
-	vocab_hash = make([]int, vocab_hash_size)
 	TrainModel()
 	os.Exit(0)
 }
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
+var adagrad int = 0
+var syn0_g2, syn1neg_g2 []float64 // Accumulated squared gradients of syn0 and syn1neg
+
+// Allocates the AdaGrad accumulators of syn0 and syn1neg
+// They start at 1 so that the first updates are no larger than plain SGD ones
+func InitAdaGrad() {
+	fmt.Fprintln(os.Stderr, "InitAdaGrad")
+	syn0_g2 = make([]float64, len(syn0))
+	for a := range syn0_g2 {
+		syn0_g2[a] = 1
+	}
+	syn1neg_g2 = make([]float64, len(syn1neg))
+	for a := range syn1neg_g2 {
+		syn1neg_g2[a] = 1
+	}
+}
+
+// Returns the AdaGrad update of a parameter for the SGD update step, which is the gradient multiplied by
+// the learning rate lr; the squared gradient is accumulated in *g2 and the step is scaled down by its root
+func AdaGradStep(g2 *float64, step, lr float64) float64 {
+	if lr == 0 {
+		return 0
+	}
+	grad := step / lr
+	*g2 += grad * grad
+	return step / math.Sqrt(*g2)
+}
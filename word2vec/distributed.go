@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+)
+
+var workers int = 0
+var sync_per_iter int = 1
+var worker_id int = -1
+var worker_socket string
+
+// Sent by a worker after every part of its shard, and sent back by the coordinator with the averages
+type sync_message struct {
+	Id      int
+	Words   int64
+	Syn0    []float64
+	Syn1    []float64
+	Syn1neg []float64
+	Stopped bool // The worker was interrupted before the end of its part
+	// AdaGrad accumulators; the coordinator sends back the last ones plus the increments of all workers
+	Syn0G2    []float64
+	Syn1negG2 []float64
+}
+
+// Reported when a worker process exits
+type worker_exit struct {
+	id  int
+	err error
+}
+
+// Options of the coordinator that must not be passed on to the workers
+var coordinator_only = map[string]bool{
+	"-save-vocab": true, "-read-vocab": true, "-read-vocab-format": true, "-save-context": true,
+	"-save-model": true, "-debug": true, "-worker-id": true, "-worker-socket": true,
+}
+
+// Returns the command line of worker id
+func WorkerArgs(id int, vocab_file, socket string) []string {
+	var args []string
+	for a := 1; a < len(os.Args); a++ {
+		if coordinator_only[os.Args[a]] && a+1 < len(os.Args) {
+			a++
+			continue
+		}
+		args = append(args, os.Args[a])
+	}
+	return append(args, "-read-vocab", vocab_file, "-worker-id", strconv.Itoa(id), "-worker-socket", socket, "-debug", "0")
+}
+
+// Adds src to dst element by element
+func AddTo(dst, src []float64) {
+	for a := range dst {
+		dst[a] += src[a]
+	}
+}
+
+// Kills the worker processes that are still running
+func KillWorkers(procs []*exec.Cmd) {
+	for a := range procs {
+		procs[a].Process.Kill()
+	}
+}
+
+// Starts the worker processes, then averages their parameters after every part of every iteration;
+// the final averages are left in syn0, syn1 and syn1neg. Returns whether an interrupt cut the training short
+func RunCoordinator() bool {
+	fmt.Fprintln(os.Stderr, "RunCoordinator")
+	dir, err := os.MkdirTemp("", "word2vec")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot create a working directory: %v\n", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(dir)
+	// The workers share the vocabulary of the coordinator
+	vocab_file := filepath.Join(dir, "vocab.txt")
+	SaveVocabFile(vocab_file, "text")
+	socket := filepath.Join(dir, "sync.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot listen on %s: %v\n", socket, err)
+		os.Exit(1)
+	}
+	defer ln.Close()
+	procs := make([]*exec.Cmd, workers)
+	for a := 0; a < workers; a++ {
+		procs[a] = exec.Command(os.Args[0], WorkerArgs(a, vocab_file, socket)...)
+		procs[a].Stdout = os.Stdout
+		procs[a].Stderr = os.Stderr
+		if err := procs[a].Start(); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot start worker %d: %v\n", a, err)
+			os.Exit(1)
+		}
+	}
+	exited := make(chan worker_exit, workers)
+	for a := 0; a < workers; a++ {
+		go func(a int) {
+			exited <- worker_exit{a, procs[a].Wait()}
+		}(a)
+	}
+	// An interrupt makes the workers end the current part early, so that the round closes promptly
+	go func() {
+		<-stop_requested
+		for a := range procs {
+			procs[a].Process.Signal(syscall.SIGTERM)
+		}
+	}()
+	conns := make(chan net.Conn)
+	accept_err := make(chan error, 1)
+	go func() {
+		for a := 0; a < workers; a++ {
+			conn, err := ln.Accept()
+			if err != nil {
+				accept_err <- err
+				return
+			}
+			conns <- conn
+		}
+	}()
+	enc := make([]*gob.Encoder, workers)
+	dec := make([]*gob.Decoder, workers)
+	for a := 0; a < workers; a++ {
+		// A worker that exits before connecting, for example on an invalid option, would leave Accept waiting
+		var conn net.Conn
+		select {
+		case conn = <-conns:
+		case e := <-exited:
+			fmt.Fprintf(os.Stderr, "ERROR: worker %d exited before connecting to the coordinator\n", e.id)
+			KillWorkers(procs)
+			os.Exit(1)
+		case err := <-accept_err:
+			fmt.Fprintf(os.Stderr, "ERROR: cannot accept worker connection: %v\n", err)
+			KillWorkers(procs)
+			os.Exit(1)
+		case <-stop_requested:
+			KillWorkers(procs)
+			for a := 0; a < workers; a++ {
+				<-exited
+			}
+			return true
+		}
+		defer conn.Close()
+		var id int
+		d := gob.NewDecoder(conn)
+		if err := d.Decode(&id); err != nil || id < 0 || id >= workers || dec[id] != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: invalid worker connection\n")
+			KillWorkers(procs)
+			os.Exit(1)
+		}
+		enc[id] = gob.NewEncoder(conn)
+		dec[id] = d
+	}
+	rounds := iter * sync_per_iter
+	total_words = int64(iter) * train_words
+	for r := 0; r < rounds; r++ {
+		var avg sync_message
+		for a := 0; a < workers; a++ {
+			var msg sync_message
+			if err := dec[a].Decode(&msg); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: lost worker %d: %v\n", a, err)
+				os.Exit(1)
+			}
+			if a == 0 {
+				avg = msg
+				continue
+			}
+			avg.Words += msg.Words
+			avg.Stopped = avg.Stopped || msg.Stopped
+			AddTo(avg.Syn0, msg.Syn0)
+			AddTo(avg.Syn1, msg.Syn1)
+			AddTo(avg.Syn1neg, msg.Syn1neg)
+			AddTo(avg.Syn0G2, msg.Syn0G2)
+			AddTo(avg.Syn1negG2, msg.Syn1negG2)
+		}
+		for _, m := range [][]float64{avg.Syn0, avg.Syn1, avg.Syn1neg} {
+			for b := range m {
+				m[b] /= float64(workers)
+			}
+		}
+		// Every worker started the round from the accumulators of the coordinator
+		for _, g2 := range [][2][]float64{{avg.Syn0G2, syn0_g2}, {avg.Syn1negG2, syn1neg_g2}} {
+			for b := range g2[0] {
+				g2[0][b] -= float64(workers-1) * g2[1][b]
+			}
+		}
+		for a := 0; a < workers; a++ {
+			if err := enc[a].Encode(&avg); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: lost worker %d: %v\n", a, err)
+				os.Exit(1)
+			}
+		}
+		copy(syn0, avg.Syn0)
+		copy(syn1, avg.Syn1)
+		copy(syn1neg, avg.Syn1neg)
+		copy(syn0_g2, avg.Syn0G2)
+		copy(syn1neg_g2, avg.Syn1negG2)
+		word_count_actual += avg.Words
+		if debug_mode > 1 {
+			fmt.Fprintf(os.Stderr, "Round %d/%d: averaged %d workers, %d words trained\n", r+1, rounds, workers, avg.Words)
+		}
+		// An interrupted training keeps the averages of the last round; an interrupt that comes after the
+		// workers finished the last part does not make the training partial
+		if avg.Stopped || (Stopping() && r < rounds-1) {
+			KillWorkers(procs)
+			for a := 0; a < workers; a++ {
+				<-exited
+			}
+			return true
+		}
+	}
+	for a := 0; a < workers; a++ {
+		if e := <-exited; e.err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: worker %d failed: %v\n", e.id, e.err)
+			os.Exit(1)
+		}
+	}
+	return false
+}
+
+// Trains the shard worker_id of the training file, exchanging the parameters with the coordinator after every part
+func RunWorker() {
+	// The coordinator decides when to stop and when to save, and sends SIGTERM to end the current part early
+	signal.Ignore(syscall.SIGINT, syscall.SIGUSR1)
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM)
+	go func() {
+		<-ch
+		atomic.StoreInt32(&stop_training, 1)
+	}()
+	conn, err := net.Dial("unix", worker_socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: worker %d cannot connect to %s: %v\n", worker_id, worker_socket, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+	if err := enc.Encode(worker_id); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: worker %d: %v\n", worker_id, err)
+		os.Exit(1)
+	}
+	count := int64(workers * sync_per_iter)
+	shard := file_size / int64(workers)
+	part_size = shard / int64(sync_per_iter)
+	part_words = train_words / count
+	thread_iter = 1
+	total_words = int64(iter) * train_words / int64(workers)
+	for a := 0; a < iter; a++ {
+		for b := 0; b < sync_per_iter; b++ {
+			part_offset = shard*int64(worker_id) + part_size*int64(b)
+			before := word_count_actual
+			RunTrainThreads()
+			msg := sync_message{worker_id, word_count_actual - before, syn0, syn1, syn1neg, StoppedEarly(), syn0_g2, syn1neg_g2}
+			if err := enc.Encode(&msg); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: worker %d: %v\n", worker_id, err)
+				os.Exit(1)
+			}
+			var avg sync_message
+			if err := dec.Decode(&avg); err != nil {
+				fmt.Fprintf(os.Stderr, "ERROR: worker %d: %v\n", worker_id, err)
+				os.Exit(1)
+			}
+			copy(syn0, avg.Syn0)
+			copy(syn1, avg.Syn1)
+			copy(syn1neg, avg.Syn1neg)
+			copy(syn0_g2, avg.Syn0G2)
+			copy(syn1neg_g2, avg.Syn1negG2)
+			if Stopping() {
+				return
+			}
+		}
+	}
+}
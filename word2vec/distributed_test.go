@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Runs word2vec with the command line of the test binary instead of the tests when WORD2VEC_TEST_MAIN is set,
+// so that the coordinator started by a test can start its workers from the same binary
+func TestMain(m *testing.M) {
+	if os.Getenv("WORD2VEC_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Writes a corpus where the words of group a and of group b never share a sentence
+func writeGroupCorpus(t *testing.T, file string) {
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fo := bufio.NewWriter(f)
+	r := rand.New(rand.NewSource(1))
+	for a := 0; a < 20000; a++ {
+		group := "a"
+		if a%2 == 1 {
+			group = "b"
+		}
+		for b := 0; b < 8; b++ {
+			fmt.Fprintf(fo, "%s%d ", group, r.Intn(5))
+		}
+		fmt.Fprintf(fo, "\n")
+	}
+	if err := fo.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Reads the text vectors written by word2vec
+func readTextVectors(t *testing.T, file string) map[string][]float64 {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		t.Fatalf("%s is empty", file)
+	}
+	var words, size int
+	if _, err := fmt.Sscanf(scanner.Text(), "%d %d", &words, &size); err != nil {
+		t.Fatalf("bad header %q: %v", scanner.Text(), err)
+	}
+	vec := make(map[string][]float64)
+	for scanner.Scan() {
+		st := strings.Fields(scanner.Text())
+		if len(st) != size+1 {
+			t.Fatalf("line %q has %d fields, want %d", scanner.Text(), len(st), size+1)
+		}
+		v := make([]float64, size)
+		for b := range v {
+			v[b], err = strconv.ParseFloat(st[b+1], 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		vec[st[0]] = v
+	}
+	if len(vec) != words {
+		t.Fatalf("read %d words, the header says %d", len(vec), words)
+	}
+	return vec
+}
+
+// Returns the cosine similarity of x and y
+func cosine(x, y []float64) float64 {
+	var dot, nx, ny float64
+	for b := range x {
+		dot += x[b] * y[b]
+		nx += x[b] * x[b]
+		ny += y[b] * y[b]
+	}
+	return dot / math.Sqrt(nx*ny)
+}
+
+// Trains with a coordinator and real worker processes, and checks that the averaged vectors still separate
+// the two groups of the corpus
+func TestDistributedTraining(t *testing.T) {
+	for _, adagrad := range []string{"0", "1"} {
+		t.Run("adagrad="+adagrad, func(t *testing.T) {
+			dir := t.TempDir()
+			corpus := filepath.Join(dir, "corpus.txt")
+			output := filepath.Join(dir, "vectors.txt")
+			writeGroupCorpus(t, corpus)
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+			cmd := exec.CommandContext(ctx, os.Args[0], "-train", corpus, "-output", output, "-workers", "2",
+				"-sync-per-iter", "2", "-threads", "2", "-size", "10", "-window", "3", "-iter", "3",
+				"-min-count", "1", "-cbow", "0", "-negative", "5", "-sample", "0", "-adagrad", adagrad, "-debug", "0")
+			cmd.Env = append(os.Environ(), "WORD2VEC_TEST_MAIN=1")
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("word2vec failed: %v\n%s", err, out)
+			}
+			vec := readTextVectors(t, output)
+			if len(vec) != 11 {
+				t.Fatalf("got %d words, want 10 and </s>", len(vec))
+			}
+			var same, other float64
+			var n_same, n_other int
+			for x := 0; x < 10; x++ {
+				for y := x + 1; y < 10; y++ {
+					wx := fmt.Sprintf("%c%d", "ab"[x/5], x%5)
+					wy := fmt.Sprintf("%c%d", "ab"[y/5], y%5)
+					if x/5 == y/5 {
+						same += cosine(vec[wx], vec[wy])
+						n_same++
+					} else {
+						other += cosine(vec[wx], vec[wy])
+						n_other++
+					}
+				}
+			}
+			same /= float64(n_same)
+			other /= float64(n_other)
+			if same <= other+0.2 {
+				t.Errorf("mean similarity within groups %.3f, across groups %.3f", same, other)
+			}
+		})
+	}
+}
+
+// Checks that a coordinator whose workers cannot train fails instead of waiting for them
+func TestDistributedWorkersRejectPairs(t *testing.T) {
+	dir := t.TempDir()
+	pairs := filepath.Join(dir, "pairs.txt")
+	if err := os.WriteFile(pairs, []byte("a b\nc d\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, os.Args[0], "-train-pairs", pairs, "-output", filepath.Join(dir, "o.txt"),
+		"-workers", "2", "-debug", "0")
+	cmd.Env = append(os.Environ(), "WORD2VEC_TEST_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		t.Fatalf("word2vec did not exit:\n%s", out)
+	}
+	if err == nil || !strings.Contains(string(out), "-workers cannot be used with -train-pairs") {
+		t.Fatalf("want the -workers error, got %v:\n%s", err, out)
+	}
+}
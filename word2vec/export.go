@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var output_format string = "word2vec"
+var output_meta_file string
+var save_context_file, save_model_file string
+var combine string = "none"
+
+// Returns the companion file written next to file by the tensorboard and npy formats
+func MetaFileName(file string) string {
+	if file == output_file && output_meta_file != "" {
+		return output_meta_file
+	}
+	if output_format == "tensorboard" {
+		return strings.TrimSuffix(file, ".tsv") + ".metadata.tsv"
+	}
+	return strings.TrimSuffix(file, ".npy") + ".vocab"
+}
+
+// Creates file for writing and exits on failure
+func CreateOutput(file string) (*os.File, *bufio.Writer) {
+	f, err := os.Create(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", file)
+		os.Exit(1)
+	}
+	return f, bufio.NewWriter(f)
+}
+
+// Writes the NumPy .npy header for a float64 matrix of rows x cols
+func WriteNpyHeader(fo *bufio.Writer, rows, cols int) {
+	header := fmt.Sprintf("{'descr': '<f8', 'fortran_order': False, 'shape': (%d, %d), }", rows, cols)
+	// Magic, version and header length take 10 bytes; pad so that the data starts on a 64 byte boundary
+	pad := 64 - (10+len(header)+1)%64
+	if pad == 64 {
+		pad = 0
+	}
+	header += strings.Repeat(" ", pad) + "\n"
+	fo.WriteString("\x93NUMPY")
+	fo.WriteByte(1)
+	fo.WriteByte(0)
+	binary.Write(fo, binary.LittleEndian, uint16(len(header)))
+	fo.WriteString(header)
+}
+
+// Saves the vectors vec of the vocabulary words to file in output_format
+func SaveVectors(file string, vec []float64) {
+	SaveVectorsFor(file, vocab, vocab_size, vec)
+}
+
+// Saves the vectors vec of the first n words of v to file in output_format
+func SaveVectorsFor(file string, v vocab_slice, n int, vec []float64) {
+	f, fo := CreateOutput(file)
+	defer f.Close()
+	switch output_format {
+	case "glove":
+		for a := 0; a < n; a++ {
+			fo.WriteString(v[a].word)
+			for b := 0; b < layer1_size; b++ {
+				fmt.Fprintf(fo, " %f", vec[a*layer1_size+b])
+			}
+			fo.WriteByte('\n')
+		}
+	case "tensorboard":
+		for a := 0; a < n; a++ {
+			for b := 0; b < layer1_size; b++ {
+				if b > 0 {
+					fo.WriteByte('\t')
+				}
+				fmt.Fprintf(fo, "%f", vec[a*layer1_size+b])
+			}
+			fo.WriteByte('\n')
+		}
+		fm, fmo := CreateOutput(MetaFileName(file))
+		defer fm.Close()
+		fmt.Fprintf(fmo, "word\tcount\n")
+		for a := 0; a < n; a++ {
+			fmt.Fprintf(fmo, "%s\t%d\n", v[a].word, v[a].cn)
+		}
+		fmo.Flush()
+	case "npy":
+		WriteNpyHeader(fo, n, layer1_size)
+		binary.Write(fo, binary.LittleEndian, vec[:n*layer1_size])
+		fm, fmo := CreateOutput(MetaFileName(file))
+		defer fm.Close()
+		for a := 0; a < n; a++ {
+			fmt.Fprintf(fmo, "%s %d\n", v[a].word, v[a].cn)
+		}
+		fmo.Flush()
+	default:
+		fmt.Fprintf(fo, "%d %d\n", n, layer1_size)
+		for a := 0; a < n; a++ {
+			fmt.Fprintf(fo, "%s ", v[a].word)
+			if binaryf != 0 {
+				binary.Write(fo, binary.LittleEndian, vec[a*layer1_size:(a+1)*layer1_size])
+			} else {
+				for b := 0; b < layer1_size; b++ {
+					fmt.Fprintf(fo, "%f ", vec[a*layer1_size+b])
+				}
+			}
+			fmt.Fprintf(fo, "\n")
+		}
+	}
+	if err := fo.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot write %s: %v\n", file, err)
+		os.Exit(1)
+	}
+}
+
+// Returns syn0 + syn1neg, or their average, as requested by -combine
+func CombinedVectors() []float64 {
+	vec := make([]float64, vocab_size*layer1_size)
+	for a := range vec {
+		vec[a] = syn0[a] + syn1neg[a]
+		if combine == "avg" {
+			vec[a] /= 2
+		}
+	}
+	return vec
+}
+
+// Returns the resulting word vectors: syn0, or its combination with the context vectors when -combine is given
+func OutputVectors() []float64 {
+	if combine != "none" {
+		return CombinedVectors()
+	}
+	return syn0
+}
+
+// Saves the whole training state to file: a text header and vocabulary followed by syn0, syn1 and syn1neg
+// as little endian float64 matrices; syn1 and syn1neg are present only when hs and negative are used
+// The header holds vocab_size, layer1_size, hs, negative, cbow, structured, window_left and window_right,
+// which determine the shape of syn1 and syn1neg
+func SaveModel(file string) {
+	fmt.Fprintln(os.Stderr, "SaveModel")
+	f, fo := CreateOutput(file)
+	defer f.Close()
+	fmt.Fprintf(fo, "%d %d %d %d %d %d %d %d\n", vocab_size, layer1_size, hs, negative, cbow, structured, window_left, window_right)
+	for a := 0; a < vocab_size; a++ {
+		fmt.Fprintf(fo, "%s %d\n", vocab[a].word, vocab[a].cn)
+	}
+	binary.Write(fo, binary.LittleEndian, syn0)
+	if hs != 0 {
+		binary.Write(fo, binary.LittleEndian, syn1)
+	}
+	if negative > 0 {
+		binary.Write(fo, binary.LittleEndian, syn1neg)
+	}
+	if err := fo.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot write %s: %v\n", file, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"../vecutil"
+)
+
+type hcluster_node struct {
+	path  string
+	words []int
+}
+
+// Splits the rows idx of vec into two groups with 2-means using cosine similarity
+func Bisect(vec []float64, idx []int, size int, next_random *uint64) (left, right []int) {
+	n := len(idx)
+	sub := make([]float64, n*size)
+	for a := 0; a < n; a++ {
+		copy(sub[a*size:(a+1)*size], vec[idx[a]*size:(idx[a]+1)*size])
+	}
+	inv := vecutil.InverseNorms(sub, n, size)
+	cent := vecutil.KMeansPlusPlus(sub, inv, n, size, 2, num_threads, next_random)
+	cl := make([]int, n)
+	dist := make([]float64, n)
+	centcn := make([]int, 2)
+	for a := 0; a < n; a++ {
+		cl[a] = -1
+	}
+	for a := 0; a < classes_iter; a++ {
+		changed := vecutil.KMeansAssign(sub, inv, cent, cl, dist, n, size, 2, num_threads)
+		vecutil.KMeansUpdate(sub, cent, cl, centcn, n, size, 2)
+		if float64(changed) <= classes_tol*float64(n) {
+			break
+		}
+	}
+	for a := 0; a < n; a++ {
+		if cl[a] == 0 {
+			left = append(left, idx[a])
+		} else {
+			right = append(right, idx[a])
+		}
+	}
+	return
+}
+
+// Builds a binary hierarchy over the rows of vec by recursive bisection, down to at most depth levels
+// Returns the leaves in depth-first order; the path of a leaf is its bit-string from the root
+func HierarchicalClusters(vec []float64, n, size, depth int) []hcluster_node {
+	var next_random uint64 = 1
+	var leaves []hcluster_node
+	root := hcluster_node{"", make([]int, n)}
+	for a := 0; a < n; a++ {
+		root.words[a] = a
+	}
+	stack := []hcluster_node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if len(node.words) < 2 || len(node.path) >= depth {
+			leaves = append(leaves, node)
+			continue
+		}
+		left, right := Bisect(vec, node.words, size, &next_random)
+		if len(left) == 0 || len(right) == 0 {
+			// The vectors cannot be separated any further
+			leaves = append(leaves, node)
+			continue
+		}
+		// Push the right child first so that the left one is expanded first
+		stack = append(stack, hcluster_node{node.path + "1", right})
+		stack = append(stack, hcluster_node{node.path + "0", left})
+	}
+	// An unsplit root is the only leaf; it gets the path 0 so that no bit-string is empty
+	if len(leaves) == 1 && leaves[0].path == "" {
+		leaves[0].path = "0"
+	}
+	return leaves
+}
+
+// Writes the hierarchical cluster bit-string of every word of the resulting vectors in the Brown clustering paths format
+func SaveHierarchicalClusters(fo *bufio.Writer) {
+	leaves := HierarchicalClusters(OutputVectors(), vocab_size, layer1_size, hclusters)
+	if debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "Hierarchical clusters: %d leaves\n", len(leaves))
+	}
+	for _, leaf := range leaves {
+		for _, a := range leaf.words {
+			fmt.Fprintf(fo, "%s\t%s\t%d\n", leaf.path, vocab[a].word, vocab[a].cn)
+		}
+	}
+}
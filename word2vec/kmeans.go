@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"../vecutil"
+)
+
+// Runs K-means on the resulting word vectors and writes the classes, and optionally the centroids and class sizes
+func SaveClasses(fo *bufio.Writer) {
+	cl, cent, dist, centcn := vecutil.KMeans(OutputVectors(), vocab_size, layer1_size, classes, classes_iter, classes_tol, num_threads, debug_mode > 0)
+	// Save the K-means classes
+	for a := 0; a < vocab_size; a++ {
+		if classes_dist != 0 {
+			fmt.Fprintf(fo, "%s %d %f\n", vocab[a].word, cl[a], dist[a])
+		} else {
+			fmt.Fprintf(fo, "%s %d\n", vocab[a].word, cl[a])
+		}
+	}
+	if save_centroids_file != "" {
+		f, err := os.Create(save_centroids_file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", save_centroids_file)
+			os.Exit(1)
+		}
+		defer f.Close()
+		fc := bufio.NewWriter(f)
+		fmt.Fprintf(fc, "%d %d\n", len(centcn), layer1_size)
+		for a := 0; a < len(centcn); a++ {
+			fmt.Fprintf(fc, "%d ", a)
+			if binaryf != 0 {
+				binary.Write(fc, binary.LittleEndian, cent[a*layer1_size:(a+1)*layer1_size])
+			} else {
+				for b := 0; b < layer1_size; b++ {
+					fmt.Fprintf(fc, "%f ", cent[a*layer1_size+b])
+				}
+			}
+			fmt.Fprintf(fc, "\n")
+		}
+		fc.Flush()
+	}
+	if save_class_sizes_file != "" {
+		f, err := os.Create(save_class_sizes_file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot create %s\n", save_class_sizes_file)
+			os.Exit(1)
+		}
+		defer f.Close()
+		fs := bufio.NewWriter(f)
+		for a := 0; a < len(centcn); a++ {
+			fmt.Fprintf(fs, "%d %d\n", a, centcn[a])
+		}
+		fs.Flush()
+	}
+}
@@ -3,13 +3,13 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"io"
 	"math"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -23,7 +23,10 @@ const MAX_CODE_LENGTH int = 40
 
 const SEEK_SET int = 0
 
-const vocab_hash_size int = 30000000 // Maximum 30 * 0.7 = 21M words in the vocabulary
+const vocab_hash_min_size int = 1024   // The hash table starts with this many slots and doubles when 70% full
+const vocab_reduce_size int = 21000000 // Infrequent words are pruned when the vocabulary grows beyond 21M words
+
+const vocab_entry_bytes int64 = 100 // Approximate memory used by a vocabulary entry besides the word itself
 
 //type real float64 // Precision of float numbers
 
@@ -42,7 +45,11 @@ func (me vocab_slice) Len() int {
 }
 
 func (me vocab_slice) Less(i, j int) bool {
-	return me[i].cn > me[j].cn
+	// Ties are broken by the word itself so that frequency cut-offs are the same in every run
+	if me[i].cn != me[j].cn {
+		return me[i].cn > me[j].cn
+	}
+	return me[i].word < me[j].word
 }
 
 func (me vocab_slice) Swap(i, j int) {
@@ -58,18 +65,40 @@ var binaryf int = 0
 var cbow int = 1
 var debug_mode int = 2
 var window int = 5
+var window_left, window_right int = -1, -1
+var window_mode string = "dynamic"
+var max_sentence_length int = MAX_SENTENCE_LENGTH
+var doc_mode bool = false
+var doc_separator string
 var min_count int = 5
 var num_threads int = 12
 var min_reduce int = 1
+var max_vocab int = 0
+var vocab_mem_mb int64 = 0
+var vocab_word_bytes int64 = 0
+var min_count_dropped_words, min_count_dropped_tokens int64 = 0, 0
+var max_vocab_dropped_words, max_vocab_dropped_tokens int64 = 0, 0
+var reduce_dropped_words, reduce_dropped_tokens int64 = 0, 0
 var vocab_hash []int
+var vocab_hash_size int = 0
 var vocab_max_size int = 1000
 var vocab_size int = 0
 var layer1_size int = 100
+var layer2_size int = 100
+var structured int = 0
 var train_words int64 = 0
 var word_count_actual int64 = 0
 var iter int = 5
 var file_size int64 = 0
+var part_offset, part_size, part_words int64 = 0, 0, 0 // The part of the training file used by the threads
+var thread_iter int = 0                                // Passes of the threads over their part
+var total_words int64 = 0                              // Words to be trained on by this process in all iterations
 var classes int = 0
+var classes_iter int = 10
+var classes_tol float64 = 0
+var classes_dist int = 0
+var save_centroids_file, save_class_sizes_file string
+var hclusters int = 0
 var alpha float64 = 0.025
 var starting_alpha float64
 var sample float64 = 1e-3
@@ -82,35 +111,8 @@ var start time.Time
 var hs int = 0
 var negative int = 5
 
-const table_size int = 1e8
-
-var table []int
-
 var m *sync.Mutex = new(sync.Mutex)
 
-func InitUnigramTable() {
-	fmt.Fprintln(os.Stderr, "InitUnigramTable")
-	var train_words_pow float64 = 0
-	var d1 float64
-	var power float64 = 0.75
-	table = make([]int, table_size)
-	for a := 0; a < vocab_size; a++ {
-		train_words_pow += math.Pow(float64(vocab[a].cn), power)
-	}
-	i := 0
-	d1 = math.Pow(float64(vocab[i].cn), power) / train_words_pow
-	for a := 0; a < table_size; a++ {
-		table[a] = i
-		if float64(a)/float64(table_size) > d1 {
-			i++
-			d1 += math.Pow(float64(vocab[i].cn), power) / train_words_pow
-		}
-		if i >= vocab_size {
-			i = vocab_size - 1
-		}
-	}
-}
-
 // Reads a single word from a file, assuming space + tab + EOL to be word boundaries
 func ReadWord(fin *bufio.Reader) (word string, err error) {
 	var a int = 0
@@ -148,14 +150,16 @@ func ReadWord(fin *bufio.Reader) (word string, err error) {
 	return
 }
 
-// Returns hash value of a word
+// Returns hash value of a word; FNV-1a mixes every byte into the low bits, which the power of two table
+// size needs, so that words sharing a prefix do not crowd into neighbouring slots
 func GetWordHash(word string) uint {
-	var hash uint = 0
+	var hash uint64 = 14695981039346656037
 	for a := 0; a < len(word); a++ {
-		hash = hash*257 + uint(word[a])
+		hash ^= uint64(word[a])
+		hash *= 1099511628211
 	}
-	hash = hash % uint(vocab_hash_size)
-	return hash
+	hash ^= hash >> 32
+	return uint(hash % uint64(vocab_hash_size))
 }
 
 // Returns position of a word in the vocabulary; if the word is not found, returns -1
@@ -170,7 +174,57 @@ func SearchVocab(word string) int {
 		}
 		hash = (hash + 1) % uint(vocab_hash_size)
 	}
-	return -1
+}
+
+// Allocates an empty hash table large enough for n words
+func InitVocabHash(n int) {
+	size := vocab_hash_min_size
+	for float64(n) > float64(size)*0.7 {
+		size *= 2
+	}
+	vocab_hash_size = size
+	vocab_hash = make([]int, vocab_hash_size)
+	for a := 0; a < vocab_hash_size; a++ {
+		vocab_hash[a] = -1
+	}
+}
+
+// Rebuilds the hash table for the first vocab_size words, resizing it to fit
+func RehashVocab() {
+	var hash uint
+	InitVocabHash(vocab_size)
+	for a := 0; a < vocab_size; a++ {
+		hash = GetWordHash(vocab[a].word)
+		for vocab_hash[hash] != -1 {
+			hash = (hash + 1) % uint(vocab_hash_size)
+		}
+		vocab_hash[hash] = a
+	}
+}
+
+// Reads a word of a training sequence and returns its index in the vocabulary; end is true when it closes the sequence
+// Sequences are lines, or documents in doc_mode, which end at a doc_separator token, or at an empty line when
+// doc_separator is empty; newline tracks whether the previous word was a line break
+func ReadSequenceWord(fin *bufio.Reader, newline *bool) (word int, end bool, err error) {
+	if !doc_mode {
+		word, err = ReadWordIndex(fin)
+		return word, word == 0, err
+	}
+	w, err := ReadWord(fin)
+	if err == io.EOF {
+		return -1, false, err
+	}
+	if w == "</s>" {
+		end = doc_separator == "" && *newline
+		*newline = true
+		return 0, end, nil
+	}
+	*newline = false
+	// The separator only ends the document; like </s>, it is not a word of its own
+	if doc_separator != "" && w == doc_separator {
+		return 0, true, nil
+	}
+	return SearchVocab(w), false, nil
 }
 
 // Reads a word and returns its index in the vocabulary
@@ -193,10 +247,16 @@ func AddWordToVocab(word string) int {
 	vocab[vocab_size].word = word
 	vocab[vocab_size].cn = 0
 	vocab_size++
+	vocab_word_bytes += int64(len(word))
 	// Reallocate memory if needed
 	if vocab_size+2 >= vocab_max_size {
-		vocab_max_size += 1000
-		vocab = append(vocab, make([]vocab_word, 1000)...)
+		vocab = append(vocab, make([]vocab_word, vocab_max_size)...)
+		vocab_max_size *= 2
+	}
+	// Grow the hash table when it is 70% full
+	if float64(vocab_size) > float64(vocab_hash_size)*0.7 {
+		RehashVocab()
+		return vocab_size - 1
 	}
 	hash = GetWordHash(word)
 	for vocab_hash[hash] != -1 {
@@ -209,30 +269,31 @@ func AddWordToVocab(word string) int {
 // Sorts the vocabulary by frequency using word counts
 func SortVocab() {
 	fmt.Fprintln(os.Stderr, "SortVocab")
-	var hash uint
 	// Sort the vocabulary and keep </s> at the first position
-	sort.Sort(vocab[1:])
-	for a := 0; a < vocab_hash_size; a++ {
-		vocab_hash[a] = -1
-	}
+	sort.Sort(vocab[1:vocab_size])
 	size := vocab_size
 	train_words = 0
 	for a := 0; a < size; a++ {
 		// Words occuring less than min_count times will be discarded from the vocab
 		if (vocab[a].cn < min_count) && (a != 0) {
+			min_count_dropped_words++
+			min_count_dropped_tokens += int64(vocab[a].cn)
+			vocab_size--
+			vocab[a].word = ""
+		} else if max_vocab > 0 && a > max_vocab {
+			// Only the max_vocab most frequent words are kept; </s> at the first position is not counted
+			max_vocab_dropped_words++
+			max_vocab_dropped_tokens += int64(vocab[a].cn)
 			vocab_size--
 			vocab[a].word = ""
 		} else {
-			// Hash will be re-computed, as after the sorting it is not actual
-			hash = GetWordHash(vocab[a].word)
-			for vocab_hash[hash] != -1 {
-				hash = (hash + 1) % uint(vocab_hash_size)
-			}
-			vocab_hash[hash] = a
 			train_words += int64(vocab[a].cn)
 		}
 	}
 	vocab = vocab[:vocab_size+1]
+	vocab_max_size = vocab_size + 1
+	// Hash will be re-computed, as after the sorting it is not actual
+	RehashVocab()
 	// Allocate memory for the binary tree construction
 	for a := 0; a < vocab_size; a++ {
 		vocab[a].code = make([]byte, MAX_CODE_LENGTH)
@@ -244,32 +305,43 @@ func SortVocab() {
 func ReduceVocab() {
 	fmt.Fprintln(os.Stderr, "ReduceVocab")
 	var b int = 0
-	var hash uint
+	vocab_word_bytes = 0
 	for a := 0; a < vocab_size; a++ {
-		if vocab[a].cn > min_reduce {
+		// </s> is always kept at the first position
+		if vocab[a].cn > min_reduce || a == 0 {
 			vocab[b].cn = vocab[a].cn
 			vocab[b].word = vocab[a].word
+			vocab_word_bytes += int64(len(vocab[b].word))
 			b++
 		} else {
+			reduce_dropped_words++
+			reduce_dropped_tokens += int64(vocab[a].cn)
 			vocab[a].word = ""
 		}
 	}
 	vocab_size = b
-	for a := 0; a < vocab_hash_size; a++ {
-		vocab_hash[a] = -1
-	}
-	for a := 0; a < vocab_size; a++ {
-		// Hash will be re-computed, as it is not actual
-		hash = GetWordHash(vocab[a].word)
-		for vocab_hash[hash] != -1 {
-			hash = (hash + 1) % uint(vocab_hash_size)
-		}
-		vocab_hash[hash] = a
-	}
+	// Hash will be re-computed, as it is not actual
+	RehashVocab()
 	//  fflush(stdout);
 	min_reduce++
 }
 
+// Returns the approximate memory used by the vocabulary in bytes
+func VocabMemory() int64 {
+	return int64(vocab_size)*vocab_entry_bytes + vocab_word_bytes
+}
+
+// Prints how many words and tokens were removed from the vocabulary by each cut-off
+func ReportVocabDrops() {
+	if reduce_dropped_words > 0 {
+		fmt.Fprintf(os.Stderr, "Dropped while counting (memory limit): %d words, %d tokens\n", reduce_dropped_words, reduce_dropped_tokens)
+	}
+	fmt.Fprintf(os.Stderr, "Dropped by min-count: %d words, %d tokens\n", min_count_dropped_words, min_count_dropped_tokens)
+	if max_vocab > 0 {
+		fmt.Fprintf(os.Stderr, "Dropped by max-vocab: %d words, %d tokens\n", max_vocab_dropped_words, max_vocab_dropped_tokens)
+	}
+}
+
 // Create binary Huffman tree using the word counts
 // Frequent words will have short uniqe binary codes
 func CreateBinaryTree() {
@@ -347,9 +419,7 @@ func LearnVocabFromTrainFile() {
 	var word string
 	var fin *bufio.Reader
 	var i int
-	for a := 0; a < vocab_hash_size; a++ {
-		vocab_hash[a] = -1
-	}
+	InitVocabHash(0)
 	f, err := os.Open(train_file)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "ERROR: training data file not found!\n")
@@ -369,6 +439,10 @@ func LearnVocabFromTrainFile() {
 			fmt.Fprintf(os.Stderr, "%dK%c", train_words/1000, 13)
 			//      fflush(stdout);
 		}
+		// The document separator is counted as a sequence end instead of getting a vector
+		if doc_separator != "" && word == doc_separator {
+			word = "</s>"
+		}
 		i = SearchVocab(word)
 		if i == -1 {
 			a := AddWordToVocab(word)
@@ -376,65 +450,22 @@ func LearnVocabFromTrainFile() {
 		} else {
 			vocab[i].cn++
 		}
-		if float64(vocab_size) > float64(vocab_hash_size)*0.7 {
+		if vocab_size > vocab_reduce_size {
 			ReduceVocab()
 		}
-	}
-	SortVocab()
-	if debug_mode > 0 {
-		fmt.Fprintf(os.Stderr, "Vocab size: %d\n", vocab_size)
-		fmt.Fprintf(os.Stderr, "Words in train file: %d\n", train_words)
-	}
-	fi, _ := os.Stat(train_file)
-	file_size = fi.Size()
-}
-
-func SaveVocab() {
-	fmt.Fprintln(os.Stderr, "SaveVocab")
-	f, _ := os.Create(save_vocab_file)
-	defer f.Close()
-	fo := bufio.NewWriter(f)
-	for i := 0; i < vocab_size; i++ {
-		fmt.Fprintf(fo, "%s %d\n", vocab[i].word, vocab[i].cn)
-	}
-	fo.Flush()
-}
-
-func ReadVocab() {
-	fmt.Fprintln(os.Stderr, "ReadVocab")
-	var i int64 = 0
-	var c byte
-	var word string
-	f, err := os.Open(train_file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Vocabulary file not found\n")
-		os.Exit(1)
-	}
-	defer f.Close()
-	fin := bufio.NewReader(f)
-	for a := 0; a < vocab_hash_size; a++ {
-		vocab_hash[a] = -1
-	}
-	vocab_size = 0
-	for {
-		word, err = ReadWord(fin)
-		if err == io.EOF {
-			break
+		// Prune until the vocabulary fits again, so that the next words do not each trigger a reduction;
+		// this ends at the latest when only </s> is left
+		for vocab_mem_mb > 0 && VocabMemory() > vocab_mem_mb<<20 {
+			ReduceVocab()
 		}
-		a := AddWordToVocab(word)
-		fmt.Fscanf(fin, "%d%c", &vocab[a].cn, &c)
-		i++
 	}
 	SortVocab()
 	if debug_mode > 0 {
 		fmt.Fprintf(os.Stderr, "Vocab size: %d\n", vocab_size)
 		fmt.Fprintf(os.Stderr, "Words in train file: %d\n", train_words)
+		ReportVocabDrops()
 	}
-	fi, err := os.Stat(train_file)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "ERROR: training data file not found!\n")
-		os.Exit(1)
-	}
+	fi, _ := os.Stat(train_file)
 	file_size = fi.Size()
 }
 
@@ -442,19 +473,33 @@ func InitNet() {
 	fmt.Fprintln(os.Stderr, "InitNet")
 	var next_random uint64 = 1
 	syn0 = make([]float64, vocab_size*layer1_size)
+	// Position-aware models need an output layer for every position of the window: structured skip-gram
+	// has a set of output vectors per position, CWindow output vectors span the concatenated context
+	var syn1_rows int = vocab_size
+	layer2_size = layer1_size
+	if train_pairs_file != "" {
+		syn1_rows = context_size
+	}
+	if structured != 0 {
+		if cbow != 0 {
+			layer2_size = (window_left + window_right) * layer1_size
+		} else {
+			syn1_rows = vocab_size * (window_left + window_right)
+		}
+	}
 	if hs != 0 {
-		syn1 = make([]float64, vocab_size*layer1_size)
-		for a := 0; a < vocab_size; a++ {
-			for b := 0; b < layer1_size; b++ {
-				syn1[a*layer1_size+b] = 0
+		syn1 = make([]float64, syn1_rows*layer2_size)
+		for a := 0; a < syn1_rows; a++ {
+			for b := 0; b < layer2_size; b++ {
+				syn1[a*layer2_size+b] = 0
 			}
 		}
 	}
 	if negative > 0 {
-		syn1neg = make([]float64, vocab_size*layer1_size)
-		for a := 0; a < vocab_size; a++ {
-			for b := 0; b < layer1_size; b++ {
-				syn1neg[a*layer1_size+b] = 0
+		syn1neg = make([]float64, syn1_rows*layer2_size)
+		for a := 0; a < syn1_rows; a++ {
+			for b := 0; b < layer2_size; b++ {
+				syn1neg[a*layer2_size+b] = 0
 			}
 		}
 	}
@@ -464,57 +509,98 @@ func InitNet() {
 			syn0[a*layer1_size+b] = ((float64(next_random&0xFFFF) / float64(65536)) - 0.5) / float64(layer1_size)
 		}
 	}
+	if init_vectors_file != "" {
+		LoadInitVectors()
+	}
+	if adagrad != 0 {
+		InitAdaGrad()
+	}
 	CreateBinaryTree()
 }
 
+// Returns the number of context words used on a side of full size w when the window is shrunk by b
+func ShrinkWindow(w, b int) int {
+	return (w*(window-b) + window - 1) / window
+}
+
+// Returns the weight of the context word at offset a from the current word
+func WindowWeight(a int) float64 {
+	d := a
+	w := window_right
+	if a < 0 {
+		d = -a
+		w = window_left
+	}
+	switch window_mode {
+	case "harmonic":
+		return 1 / float64(d)
+	case "linear":
+		return float64(w-d+1) / float64(w)
+	}
+	return 1
+}
+
+// Returns the index of offset a among the window_left + window_right positions of the window
+func WindowPosition(a int) int {
+	if a < 0 {
+		return a + window_left
+	}
+	return a + window_left - 1
+}
+
 func TrainModelThread(id int) {
 	fmt.Fprintln(os.Stderr, "TrainModelThread")
 	var a, b, d, cw, word, last_word int
 	var sentence_length, sentence_position int = 0, 0
 	var word_count, last_word_count int64 = 0, 0
-	var sen []int = make([]int, MAX_SENTENCE_LENGTH+1)
-	var l1, l2, c, target, label int
-	var local_iter int = iter
+	var sen []int = make([]int, max_sentence_length+1)
+	var end, newline bool
+	var l0, l1, l2, c, target, label int
+	var local_iter int = thread_iter
 	var next_random uint64 = uint64(id)
-	var f, g float64
-	var now time.Time
-	var neu1 []float64 = make([]float64, layer1_size)
-	var neu1e []float64 = make([]float64, layer1_size)
+	var thread_alpha float64 = UpdateAlpha()
+	var f, g, wt, cww, lr float64
+	var left, right int
+	var neu1 []float64 = make([]float64, layer2_size)
+	var neu1e []float64 = make([]float64, layer2_size)
 	fi, _ := os.Open(train_file)
 	defer fi.Close()
-	fi.Seek(file_size/int64(num_threads)*int64(id), SEEK_SET)
+	fi.Seek(part_offset+part_size/int64(num_threads)*int64(id), SEEK_SET)
 	br := bufio.NewReader(fi)
 	for {
 		if word_count-last_word_count > 10000 {
 			//			word_count_actual += word_count - last_word_count
 			atomic.AddInt64(&word_count_actual, word_count-last_word_count)
 			last_word_count = word_count
+			thread_alpha = UpdateAlpha()
 			if debug_mode > 1 {
-				now = time.Now()
-				fmt.Fprintf(os.Stderr, "%cAlpha: %f  Progress: %.2f%%  Words/thread/sec: %.2fk  ", 13, alpha,
-					float64(word_count_actual)/float64(int64(iter)*train_words+1)*100,
-					float64(word_count_actual)/(float64(now.Unix()-start.Unix()+1)*1000))
+				ReportProgress("Words")
 				//				fflush(stdout)
 			}
-			alpha = starting_alpha * (1 - float64(word_count_actual)/float64(int64(iter)*train_words+1))
-			if alpha < starting_alpha*0.0001 {
-				alpha = starting_alpha * 0.0001
-			}
+		}
+		// Stop between sentences when the training was interrupted
+		if sentence_length == 0 && Stopping() {
+			atomic.AddInt64(&word_count_actual, word_count-last_word_count)
+			StopEarly()
+			break
 		}
 		var err error
 		if sentence_length == 0 {
 			for {
-				word, err = ReadWordIndex(br)
+				word, end, err = ReadSequenceWord(br, &newline)
 				if err == io.EOF {
 					break
 				}
-				if word == -1 {
-					continue
+				if word != -1 {
+					word_count++
 				}
-				word_count++
-				if word == 0 {
+				if end {
 					break
 				}
+				// Out of vocabulary words and line breaks inside a document are skipped
+				if word <= 0 {
+					continue
+				}
 				// The subsampling randomly discards frequent words while keeping the ranking same
 				if sample > 0 {
 					var ran float64 = math.Sqrt(float64(vocab[word].cn)/(sample*float64(train_words))) + 1*(sample*float64(train_words))/float64(vocab[word].cn)
@@ -525,14 +611,14 @@ func TrainModelThread(id int) {
 				}
 				sen[sentence_length] = word
 				sentence_length++
-				if int(sentence_length) >= MAX_SENTENCE_LENGTH {
+				if int(sentence_length) >= max_sentence_length {
 					break
 				}
 			}
 			sentence_position = 0
 		}
-		if err == io.EOF || (word_count > train_words/int64(num_threads)) {
-			word_count_actual += word_count - last_word_count
+		if err == io.EOF || (word_count > part_words/int64(num_threads)) {
+			atomic.AddInt64(&word_count_actual, word_count-last_word_count)
 			local_iter--
 			if local_iter == 0 {
 				break
@@ -540,7 +626,7 @@ func TrainModelThread(id int) {
 			word_count = 0
 			last_word_count = 0
 			sentence_length = 0
-			fi.Seek(file_size/int64(num_threads)*int64(id), SEEK_SET)
+			fi.Seek(part_offset+part_size/int64(num_threads)*int64(id), SEEK_SET)
 			br = bufio.NewReader(fi)
 			continue
 		}
@@ -548,20 +634,26 @@ func TrainModelThread(id int) {
 		if word == -1 {
 			continue
 		}
-		for c = 0; c < layer1_size; c++ {
+		for c = 0; c < layer2_size; c++ {
 			neu1[c] = 0
 		}
-		for c = 0; c < layer1_size; c++ {
+		for c = 0; c < layer2_size; c++ {
 			neu1e[c] = 0
 		}
-		next_random = next_random*uint64(25214903917) + 11
-		b = int(next_random % uint64(window))
-		if cbow != 0 { //train the cbow architecture
-			// in -> hidden
+		// Choose the part of the window used for this word
+		left, right = window_left, window_right
+		if window_mode == "dynamic" {
+			next_random = next_random*uint64(25214903917) + 11
+			b = int(next_random % uint64(window))
+			left, right = ShrinkWindow(left, b), ShrinkWindow(right, b)
+		}
+		if cbow != 0 { //train the cbow architecture, or CWindow when structured
+			// in -> hidden; CWindow concatenates the context vectors by position instead of averaging them
 			cw = 0
-			for a = b; a < window*2+1-b; a++ {
-				if a != window {
-					c = sentence_position - window + a
+			cww = 0
+			for a = -left; a <= right; a++ {
+				if a != 0 {
+					c = sentence_position + a
 					if c < 0 {
 						continue
 					}
@@ -572,22 +664,30 @@ func TrainModelThread(id int) {
 					if last_word == -1 {
 						continue
 					}
+					wt = WindowWeight(a)
+					l1 = 0
+					if structured != 0 {
+						l1 = WindowPosition(a) * layer1_size
+					}
 					for c = 0; c < layer1_size; c++ {
-						neu1[c] += syn0[c+last_word*layer1_size]
+						neu1[c+l1] += wt * syn0[c+last_word*layer1_size]
 					}
 					cw++
+					cww += wt
 				}
 			}
 			if cw != 0 {
-				for c = 0; c < layer1_size; c++ {
-					neu1[c] /= float64(cw)
+				if structured == 0 {
+					for c = 0; c < layer1_size; c++ {
+						neu1[c] /= cww
+					}
 				}
 				if hs != 0 {
 					for d = 0; d < int(vocab[word].codelen); d++ {
 						f = 0
-						l2 = vocab[word].point[d] * layer1_size
+						l2 = vocab[word].point[d] * layer2_size
 						// Propagate hidden -> output
-						for c = 0; c < layer1_size; c++ {
+						for c = 0; c < layer2_size; c++ {
 							f += neu1[c] * syn1[c+l2]
 						}
 						if f <= -MAX_EXP {
@@ -598,13 +698,13 @@ func TrainModelThread(id int) {
 							f = expTable[(int)((f+MAX_EXP)*(float64(EXP_TABLE_SIZE)/MAX_EXP/2))]
 						}
 						// 'g' is the gradient multiplied by the learning rate
-						g = (1 - float64(vocab[word].code[d]) - f) * alpha
+						g = (1 - float64(vocab[word].code[d]) - f) * thread_alpha
 						// Propagate errors output -> hidden
-						for c = 0; c < layer1_size; c++ {
+						for c = 0; c < layer2_size; c++ {
 							neu1e[c] += g * syn1[c+l2]
 						}
 						// Learn weights hidden -> output
-						for c = 0; c < layer1_size; c++ {
+						for c = 0; c < layer2_size; c++ {
 							syn1[c+l2] += g * neu1[c]
 						}
 					}
@@ -616,40 +716,42 @@ func TrainModelThread(id int) {
 							target = word
 							label = 1
 						} else {
-							next_random = next_random*uint64(25214903917) + 11
-							target = table[(next_random>>16)%uint64(table_size)]
-							if target == 0 {
-								target = int(next_random%uint64(vocab_size-1)) + 1
-							}
+							target = sampler.Sample(&next_random)
 							if target == word {
 								continue
 							}
 							label = 0
 						}
-						l2 = target * layer1_size
+						l2 = target * layer2_size
 						f = 0
-						for c = 0; c < layer1_size; c++ {
+						for c = 0; c < layer2_size; c++ {
 							f += neu1[c] * syn1neg[c+l2]
 						}
 						if f > MAX_EXP {
-							g = float64(label-1) * alpha
+							g = float64(label-1) * thread_alpha
 						} else if f < -MAX_EXP {
-							g = float64(label-0) * alpha
+							g = float64(label-0) * thread_alpha
 						} else {
-							g = (float64(label) - expTable[(int)((f+MAX_EXP)*(float64(EXP_TABLE_SIZE)/MAX_EXP/2))]) * alpha
+							g = (float64(label) - expTable[(int)((f+MAX_EXP)*(float64(EXP_TABLE_SIZE)/MAX_EXP/2))]) * thread_alpha
 						}
-						for c = 0; c < layer1_size; c++ {
+						for c = 0; c < layer2_size; c++ {
 							neu1e[c] += g * syn1neg[c+l2]
 						}
-						for c = 0; c < layer1_size; c++ {
-							syn1neg[c+l2] += g * neu1[c]
+						if adagrad != 0 {
+							for c = 0; c < layer2_size; c++ {
+								syn1neg[c+l2] += AdaGradStep(&syn1neg_g2[c+l2], g*neu1[c], thread_alpha)
+							}
+						} else {
+							for c = 0; c < layer2_size; c++ {
+								syn1neg[c+l2] += g * neu1[c]
+							}
 						}
 					}
 				}
 				// hidden -> in
-				for a = b; a < window*2+1-b; a++ {
-					if a != window {
-						c = sentence_position - window + a
+				for a = -left; a <= right; a++ {
+					if a != 0 {
+						c = sentence_position + a
 						if c < 0 {
 							continue
 						}
@@ -657,19 +759,30 @@ func TrainModelThread(id int) {
 							continue
 						}
 						last_word = sen[c]
-						if last_word == -1 {
+						if last_word == -1 || !Trainable(last_word) {
 							continue
 						}
-						for c = 0; c < layer1_size; c++ {
-							syn0[c+last_word*layer1_size] += neu1e[c]
+						wt = WindowWeight(a)
+						l1 = 0
+						if structured != 0 {
+							l1 = WindowPosition(a) * layer1_size
+						}
+						if adagrad != 0 {
+							for c = 0; c < layer1_size; c++ {
+								syn0[c+last_word*layer1_size] += AdaGradStep(&syn0_g2[c+last_word*layer1_size], wt*neu1e[c+l1], thread_alpha)
+							}
+						} else {
+							for c = 0; c < layer1_size; c++ {
+								syn0[c+last_word*layer1_size] += wt * neu1e[c+l1]
+							}
 						}
 					}
 				}
 			}
 		} else { //train skip-gram
-			for a = b; a < window*2+1-b; a++ {
-				if a != window {
-					c = sentence_position - window + a
+			for a = -left; a <= right; a++ {
+				if a != 0 {
+					c = sentence_position + a
 					if c < 0 {
 						continue
 					}
@@ -681,6 +794,13 @@ func TrainModelThread(id int) {
 						continue
 					}
 					l1 = last_word * layer1_size
+					// Structured skip-gram has separate output weights for every position in the window
+					l0 = 0
+					if structured != 0 {
+						l0 = WindowPosition(a) * vocab_size * layer1_size
+					}
+					// Context words are weighted by their distance through the learning rate
+					lr = thread_alpha * WindowWeight(a)
 					for c = 0; c < layer1_size; c++ {
 						neu1e[c] = 0
 					}
@@ -688,7 +808,7 @@ func TrainModelThread(id int) {
 					if hs != 0 {
 						for d = 0; d < int(vocab[word].codelen); d++ {
 							f = 0
-							l2 = vocab[word].point[d] * layer1_size
+							l2 = l0 + vocab[word].point[d]*layer1_size
 							// Propagate hidden -> output
 							for c = 0; c < layer1_size; c++ {
 								f += syn0[c+l1] * syn1[c+l2]
@@ -701,7 +821,7 @@ func TrainModelThread(id int) {
 								f = expTable[(int)((f+MAX_EXP)*(float64(EXP_TABLE_SIZE)/MAX_EXP/2))]
 							}
 							// 'g' is the gradient multiplied by the learning rate
-							g = (1 - float64(vocab[word].code[d]) - f) * alpha
+							g = (1 - float64(vocab[word].code[d]) - f) * lr
 							// Propagate errors output -> hidden
 							for c = 0; c < layer1_size; c++ {
 								neu1e[c] += g * syn1[c+l2]
@@ -719,39 +839,49 @@ func TrainModelThread(id int) {
 								target = word
 								label = 1
 							} else {
-								next_random = next_random*uint64(25214903917) + 11
-								target = table[(next_random>>16)%uint64(table_size)]
-								if target == 0 {
-									target = int(next_random%uint64(vocab_size-1)) + 1
-								}
+								target = sampler.Sample(&next_random)
 								if target == word {
 									continue
 								}
 								label = 0
 							}
-							l2 = target * layer1_size
+							l2 = l0 + target*layer1_size
 							f = 0
 							for c = 0; c < layer1_size; c++ {
 								f += syn0[c+l1] * syn1neg[c+l2]
 							}
 							if f > MAX_EXP {
-								g = float64(label-1) * alpha
+								g = float64(label-1) * lr
 							} else if f < -MAX_EXP {
-								g = float64(label-0) * alpha
+								g = float64(label-0) * lr
 							} else {
-								g = (float64(label) - expTable[(int)((f+MAX_EXP)*(float64(EXP_TABLE_SIZE)/MAX_EXP/2))]) * alpha
+								g = (float64(label) - expTable[(int)((f+MAX_EXP)*(float64(EXP_TABLE_SIZE)/MAX_EXP/2))]) * lr
 							}
 							for c = 0; c < layer1_size; c++ {
 								neu1e[c] += g * syn1neg[c+l2]
 							}
-							for c = 0; c < layer1_size; c++ {
-								syn1neg[c+l2] += g * syn0[c+l1]
+							if adagrad != 0 {
+								for c = 0; c < layer1_size; c++ {
+									syn1neg[c+l2] += AdaGradStep(&syn1neg_g2[c+l2], g*syn0[c+l1], lr)
+								}
+							} else {
+								for c = 0; c < layer1_size; c++ {
+									syn1neg[c+l2] += g * syn0[c+l1]
+								}
 							}
 						}
 					}
 					// Learn weights input -> hidden
-					for c = 0; c < layer1_size; c++ {
-						syn0[c+l1] += neu1e[c]
+					if Trainable(last_word) {
+						if adagrad != 0 {
+							for c = 0; c < layer1_size; c++ {
+								syn0[c+l1] += AdaGradStep(&syn0_g2[c+l1], neu1e[c], lr)
+							}
+						} else {
+							for c = 0; c < layer1_size; c++ {
+								syn0[c+l1] += neu1e[c]
+							}
+						}
 					}
 				}
 			}
@@ -764,14 +894,38 @@ func TrainModelThread(id int) {
 	}
 }
 
+// Runs the training threads and waits for them to finish
+func RunTrainThreads() {
+	ch := make(chan int, num_threads)
+	for a := 0; a < num_threads; a++ {
+		go func(a int) {
+			if train_pairs_file != "" {
+				TrainPairsThread(a)
+			} else {
+				TrainModelThread(a)
+			}
+			ch <- 0
+		}(a)
+	}
+	for a := 0; a < num_threads; a++ {
+		<-ch
+	}
+}
+
 func TrainModel() {
 	fmt.Fprintln(os.Stderr, "TrainModel")
-	var fo *bufio.Writer
-	fmt.Fprintf(os.Stderr, "Starting training using file %s\n", train_file)
 	starting_alpha = alpha
-	if read_vocab_file != "" {
+	if min_alpha < 0 {
+		min_alpha = starting_alpha * 0.0001
+	}
+	if train_pairs_file != "" {
+		fmt.Fprintf(os.Stderr, "Starting training using pairs file %s\n", train_pairs_file)
+		LearnPairVocab()
+	} else if read_vocab_file != "" {
+		fmt.Fprintf(os.Stderr, "Starting training using file %s\n", train_file)
 		ReadVocab()
 	} else {
+		fmt.Fprintf(os.Stderr, "Starting training using file %s\n", train_file)
 		LearnVocabFromTrainFile()
 	}
 	if save_vocab_file != "" {
@@ -781,93 +935,54 @@ func TrainModel() {
 		return
 	}
 	InitNet()
-	if negative > 0 {
+	if train_pairs_file != "" {
+		InitContextSampler()
+	} else if negative > 0 {
 		InitUnigramTable()
 	}
 	start = time.Now()
-	ch := make(chan int, num_threads)
-	for a := 0; a < num_threads; a++ {
-		go func(a int) {
-			TrainModelThread(a)
-			ch <- 0
-		}(a)
+	if worker_socket != "" {
+		RunWorker()
+		return
 	}
-	for a := 0; a < num_threads; a++ {
-		<-ch
+	HandleSignals()
+	stopped := false
+	if workers > 0 {
+		stopped = RunCoordinator()
+	} else {
+		part_offset, part_size, part_words = 0, file_size, train_words
+		thread_iter = iter
+		total_words = int64(iter) * train_words
+		RunTrainThreads()
+		stopped = StoppedEarly()
 	}
-	f, _ := os.Create(output_file)
-	defer f.Close()
-	fo = bufio.NewWriter(f)
-	if classes == 0 {
-		// Save the word vectors
-		fmt.Fprintf(fo, "%d %d\n", vocab_size, layer1_size)
-		for a := 0; a < vocab_size; a++ {
-			fmt.Fprintf(fo, "%s ", vocab[a].word)
-			if binaryf != 0 {
-				binary.Write(fo, binary.LittleEndian, syn0[a*layer1_size:(a+1)*layer1_size])
-			} else {
-				for b := 0; b < layer1_size; b++ {
-					fmt.Fprintf(fo, "%f ", syn0[a*layer1_size+b])
-				}
-			}
-			fmt.Fprintf(fo, "\n")
+	if stopped {
+		SavePartial()
+		os.Exit(1)
+	}
+	if save_context_file != "" {
+		if train_pairs_file != "" {
+			SaveVectorsFor(save_context_file, context_vocab, context_size, syn1neg)
+		} else {
+			SaveVectors(save_context_file, syn1neg)
 		}
+	}
+	if save_model_file != "" {
+		SaveModel(save_model_file)
+	}
+	if hclusters == 0 && classes == 0 {
+		// Save the word vectors
+		SaveVectors(output_file, OutputVectors())
+		return
+	}
+	f, fo := CreateOutput(output_file)
+	defer f.Close()
+	if hclusters > 0 {
+		// Save the hierarchical cluster bit-strings
+		SaveHierarchicalClusters(fo)
 	} else {
 		// Run K-means on the word vectors
-		var clcn int = classes
-		var iter int = 10
-		var closeid int
-		var centcn []int = make([]int, classes)
-		var cl []int = make([]int, vocab_size)
-		var closev, x float64
-		var cent []float64 = make([]float64, classes*layer1_size)
-		for a := 0; a < vocab_size; a++ {
-			cl[a] = a % clcn
-		}
-		for a := 0; a < iter; a++ {
-			for b := 0; b < clcn*layer1_size; b++ {
-				cent[b] = 0
-			}
-			for b := 0; b < clcn; b++ {
-				centcn[b] = 1
-			}
-			for c := 0; c < vocab_size; c++ {
-				for d := 0; d < layer1_size; d++ {
-					cent[layer1_size*cl[c]+d] += syn0[c*layer1_size+d]
-				}
-				centcn[cl[c]]++
-			}
-			for b := 0; b < clcn; b++ {
-				closev = 0
-				for c := 0; c < layer1_size; c++ {
-					cent[layer1_size*b+c] /= float64(centcn[b])
-					closev += cent[layer1_size*b+c] * cent[layer1_size*b+c]
-				}
-				closev = math.Sqrt(closev)
-				for c := 0; c < layer1_size; c++ {
-					cent[layer1_size*b+c] /= closev
-				}
-			}
-			for c := 0; c < vocab_size; c++ {
-				closev = -10
-				closeid = 0
-				for d := 0; d < clcn; d++ {
-					x = 0
-					for b := 0; b < layer1_size; b++ {
-						x += cent[layer1_size*d+b] * syn0[c*layer1_size+b]
-					}
-					if x > closev {
-						closev = x
-						closeid = d
-					}
-				}
-				cl[c] = closeid
-			}
-		}
-		// Save the K-means classes
-		for a := 0; a < vocab_size; a++ {
-			fmt.Fprintf(fo, "%s %d\n", vocab[a].word, cl[a])
-		}
+		SaveClasses(fo)
 	}
 	fo.Flush()
 }
@@ -895,12 +1010,29 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Parameters for training:\n")
 		fmt.Fprintf(os.Stderr, "\t-train <file>\n")
 		fmt.Fprintf(os.Stderr, "\t\tUse text data from <file> to train the model\n")
+		fmt.Fprintf(os.Stderr, "\t-train-pairs <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tTrain skip-gram with negative sampling on the 'word context' lines of <file> instead of text, with\n")
+		fmt.Fprintf(os.Stderr, "\t\tseparate word and context vocabularies (e.g. dependency-based contexts)\n")
+		fmt.Fprintf(os.Stderr, "\t-context-min-count <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tWith -train-pairs, discard contexts that appear less than <int> times; default is -min-count\n")
 		fmt.Fprintf(os.Stderr, "\t-output <file>\n")
 		fmt.Fprintf(os.Stderr, "\t\tUse <file> to save the resulting word vectors / word clusters\n")
 		fmt.Fprintf(os.Stderr, "\t-size <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tSet size of word vectors; default is 100\n")
 		fmt.Fprintf(os.Stderr, "\t-window <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tSet max skip length between words; default is 5\n")
+		fmt.Fprintf(os.Stderr, "\t-window-left <int>\n")
+		fmt.Fprintf(os.Stderr, "\t-window-right <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet max skip length to the left / right of the word for asymmetric windows; default is -window\n")
+		fmt.Fprintf(os.Stderr, "\t-window-mode <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tHow the window is used: dynamic (randomly shrunk for each word), fixed (always full), harmonic (full,\n")
+		fmt.Fprintf(os.Stderr, "\t\tcontext words weighted by 1/distance) or linear (full, weighted by (window-distance+1)/window); default is dynamic\n")
+		fmt.Fprintf(os.Stderr, "\t-max-sequence <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSplit training sequences longer than <int> words; default is 1000\n")
+		fmt.Fprintf(os.Stderr, "\t-doc-separator <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tTrain on documents instead of lines: windows span line breaks and stop only at the <string> token;\n")
+		fmt.Fprintf(os.Stderr, "\t\tthe token gets no vector; use '' to separate documents by empty lines; default is off (every line\n")
+		fmt.Fprintf(os.Stderr, "\t\tis a sequence)\n")
 		fmt.Fprintf(os.Stderr, "\t-sample <float>\n")
 		fmt.Fprintf(os.Stderr, "\t\tSet threshold for occurrence of words. Those that appear with higher frequency in the training data\n")
 		fmt.Fprintf(os.Stderr, "\t\twill be randomly down-sampled; default is 1e-3, useful range is (0, 1e-5)\n")
@@ -908,26 +1040,101 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\t\tUse Hierarchical Softmax; default is 0 (not used)\n")
 		fmt.Fprintf(os.Stderr, "\t-negative <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tNumber of negative examples; default is 5, common values are 3 - 10 (0 = not used)\n")
+		fmt.Fprintf(os.Stderr, "\t-ns-power <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tNegative examples are drawn from the unigram distribution raised to <float>; default is 0.75\n")
+		fmt.Fprintf(os.Stderr, "\t-ns-dist <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tDraw negative examples from the 'word weight' lines of <file> instead of the unigram distribution\n")
 		fmt.Fprintf(os.Stderr, "\t-threads <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tUse <int> threads (default 12)\n")
+		fmt.Fprintf(os.Stderr, "\t-workers <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tTrain with <int> local worker processes, each on its own part of the training file with -threads\n")
+		fmt.Fprintf(os.Stderr, "\t\tthreads; their parameters are averaged over a local socket; default is 0 (single process)\n")
+		fmt.Fprintf(os.Stderr, "\t-sync-per-iter <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tAverage the parameters of the workers <int> times per iteration; default is 1\n")
 		fmt.Fprintf(os.Stderr, "\t-iter <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tRun more training iterations (default 5)\n")
 		fmt.Fprintf(os.Stderr, "\t-min-count <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tThis will discard words that appear less than <int> times; default is 5\n")
+		fmt.Fprintf(os.Stderr, "\t-max-vocab <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tKeep only the <int> most frequent words (ties are broken by the word), not counting </s>; default is 0 (no limit)\n")
+		fmt.Fprintf(os.Stderr, "\t-vocab-mem <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse at most about <int> MB for the vocabulary while counting; infrequent words are pruned when\n")
+		fmt.Fprintf(os.Stderr, "\t\tthe limit is reached; default is 0 (no limit)\n")
 		fmt.Fprintf(os.Stderr, "\t-alpha <float>\n")
 		fmt.Fprintf(os.Stderr, "\t\tSet the starting learning rate; default is 0.025 for skip-gram and 0.05 for CBOW\n")
+		fmt.Fprintf(os.Stderr, "\t-min-alpha <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSet the lowest learning rate; default is 0.0001 times the starting learning rate\n")
+		fmt.Fprintf(os.Stderr, "\t-lr-schedule <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tLearning rate schedule over the whole training: linear, cosine, constant, step or warmup-linear;\n")
+		fmt.Fprintf(os.Stderr, "\t\tdefault is linear (decay from the starting learning rate to the lowest one)\n")
+		fmt.Fprintf(os.Stderr, "\t-lr-warmup <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tFraction of the training during which warmup-linear raises the learning rate; default is 0.05\n")
+		fmt.Fprintf(os.Stderr, "\t-lr-step-size <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tFraction of the training between two drops of the step schedule; default is 0.25\n")
+		fmt.Fprintf(os.Stderr, "\t-lr-step-decay <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tFactor applied to the learning rate at every drop of the step schedule; default is 0.5\n")
 		fmt.Fprintf(os.Stderr, "\t-classes <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tOutput word classes rather than word vectors; default number of classes is 0 (vectors are written)\n")
+		fmt.Fprintf(os.Stderr, "\t-classes-iter <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tMaximum number of K-means iterations; default is 10\n")
+		fmt.Fprintf(os.Stderr, "\t-classes-tol <float>\n")
+		fmt.Fprintf(os.Stderr, "\t\tStop K-means when at most this fraction of words changed class; default is 0 (stop when stable)\n")
+		fmt.Fprintf(os.Stderr, "\t-classes-dist <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tAlso write the cosine distance of each word to its class centroid; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-save-centroids <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe K-means centroids will be saved to <file> in the word vector format\n")
+		fmt.Fprintf(os.Stderr, "\t-save-class-sizes <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe number of words in each class will be saved to <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-hclusters <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tOutput hierarchical cluster bit-strings of at most <int> bits rather than word vectors, built by recursive\n")
+		fmt.Fprintf(os.Stderr, "\t\tbisection; lines are '<bits> <word> <count>' separated by tabs as in Brown clustering; default is 0 (off)\n")
 		fmt.Fprintf(os.Stderr, "\t-debug <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tSet the debug mode (default = 2 = more info during training)\n")
 		fmt.Fprintf(os.Stderr, "\t-binary <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tSave the resulting vectors in binary moded; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-output-format <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tFormat of the saved vectors: word2vec, glove (text without header), tensorboard (projector vectors TSV\n")
+		fmt.Fprintf(os.Stderr, "\t\tplus metadata TSV of word and count) or npy (NumPy float64 matrix plus vocab file); default is word2vec\n")
+		fmt.Fprintf(os.Stderr, "\t-save-context <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe context (output layer) vectors of negative sampling will be saved to <file> in -output-format\n")
+		fmt.Fprintf(os.Stderr, "\t-combine <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tSave the sum or the average of the word and context vectors as the resulting vectors: none, sum or avg;\n")
+		fmt.Fprintf(os.Stderr, "\t\trequires negative sampling; -classes and -hclusters then cluster the combined vectors; default is none\n")
+		fmt.Fprintf(os.Stderr, "\t-save-model <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe whole training state (vocabulary with counts, word, hierarchical softmax and negative sampling\n")
+		fmt.Fprintf(os.Stderr, "\t\tweights) will be saved to <file>\n")
+		fmt.Fprintf(os.Stderr, "\t-output-meta <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse <file> for the metadata / vocab file of the tensorboard and npy formats; default is derived from -output\n")
 		fmt.Fprintf(os.Stderr, "\t-save-vocab <file>\n")
 		fmt.Fprintf(os.Stderr, "\t\tThe vocabulary will be saved to <file>\n")
-		fmt.Fprintf(os.Stderr, "\t-read-vocab <file>\n")
-		fmt.Fprintf(os.Stderr, "\t\tThe vocabulary will be read from <file>, not constructed from the training data\n")
+		fmt.Fprintf(os.Stderr, "\t-read-vocab <files>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe vocabulary will be read from <files>, not constructed from the training data; the counts of\n")
+		fmt.Fprintf(os.Stderr, "\t\tseveral comma separated files are summed; without -output, -save-vocab just writes the merged file,\n")
+		fmt.Fprintf(os.Stderr, "\t\tkeeping every word regardless of -min-count and -max-vocab\n")
+		fmt.Fprintf(os.Stderr, "\t-read-vocab-format <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tFormat of the -read-vocab files: auto, text, tsv or json; auto takes the format of each file from\n")
+		fmt.Fprintf(os.Stderr, "\t\tits extension, .tsv or .json, and text otherwise; default is auto\n")
+		fmt.Fprintf(os.Stderr, "\t-vocab-format <string>\n")
+		fmt.Fprintf(os.Stderr, "\t\tFormat of -save-vocab: text (word count), tsv (with a word<TAB>count header) or json (an array\n")
+		fmt.Fprintf(os.Stderr, "\t\tof {\"word\", \"count\"} objects); default is text\n")
+		fmt.Fprintf(os.Stderr, "\t-vocab-columns <list>\n")
+		fmt.Fprintf(os.Stderr, "\t\tComma separated extra columns saved in the tsv and json formats: rank, freq (relative frequency)\n")
+		fmt.Fprintf(os.Stderr, "\t\tand cumfreq (cumulative relative frequency); they are ignored when reading\n")
+		fmt.Fprintf(os.Stderr, "\t-init-vectors <file>\n")
+		fmt.Fprintf(os.Stderr, "\t\tInitialize the vectors of words found in the model <file> from it instead of random values\n")
+		fmt.Fprintf(os.Stderr, "\t-init-binary <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tThe -init-vectors model is in binary mode; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-init-lock <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tNever update the vectors imported by -init-vectors; default is 0 (off)\n")
+		fmt.Fprintf(os.Stderr, "\t-adagrad <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tScale the updates of the word vectors and of the negative sampling weights per parameter by their\n")
+		fmt.Fprintf(os.Stderr, "\t\taccumulated squared gradients (AdaGrad); this doubles the memory used by these weights and slows\n")
+		fmt.Fprintf(os.Stderr, "\t\ttraining down by a square root per update; default is 0 (plain SGD)\n")
 		fmt.Fprintf(os.Stderr, "\t-cbow <int>\n")
 		fmt.Fprintf(os.Stderr, "\t\tUse the continuous bag of words model; default is 1 (use 0 for skip-gram model)\n")
+		fmt.Fprintf(os.Stderr, "\t-structured <int>\n")
+		fmt.Fprintf(os.Stderr, "\t\tUse the position-aware models: structured skip-gram with -cbow 0, CWindow with -cbow 1; the output\n")
+		fmt.Fprintf(os.Stderr, "\t\tlayer is window-left + window-right times larger; default is 0 (off)\n")
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "./word2vec -train data.txt -output vec.txt -size 200 -window 5 -sample 1e-4 -negative 5 -hs 0 -binary 0 -cbow 1 -iter 3\n\n")
 		return
@@ -942,12 +1149,61 @@ func main() {
 	if i := ArgPos("-train", args); i > 0 {
 		train_file = args[i+1]
 	}
+	if i := ArgPos("-train-pairs", args); i > 0 {
+		train_pairs_file = args[i+1]
+	}
+	if i := ArgPos("-context-min-count", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		context_min_count = int(v)
+	}
 	if i := ArgPos("-save-vocab", args); i > 0 {
 		save_vocab_file = args[i+1]
 	}
 	if i := ArgPos("-read-vocab", args); i > 0 {
 		read_vocab_file = args[i+1]
 	}
+	if i := ArgPos("-vocab-format", args); i > 0 {
+		vocab_format = args[i+1]
+	}
+	if !vocab_formats[vocab_format] {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown vocabulary format %s\n", vocab_format)
+		os.Exit(1)
+	}
+	if i := ArgPos("-read-vocab-format", args); i > 0 {
+		read_vocab_format = args[i+1]
+	}
+	if read_vocab_format != "auto" && !vocab_formats[read_vocab_format] {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown vocabulary format %s\n", read_vocab_format)
+		os.Exit(1)
+	}
+	if i := ArgPos("-vocab-columns", args); i > 0 {
+		vocab_columns = strings.Split(args[i+1], ",")
+	}
+	for _, name := range vocab_columns {
+		if !vocab_column_names[name] {
+			fmt.Fprintf(os.Stderr, "ERROR: unknown vocabulary column %s\n", name)
+			os.Exit(1)
+		}
+	}
+	if len(vocab_columns) > 0 && vocab_format == "text" {
+		fmt.Fprintf(os.Stderr, "ERROR: -vocab-columns needs -vocab-format tsv or json\n")
+		os.Exit(1)
+	}
+	if i := ArgPos("-init-vectors", args); i > 0 {
+		init_vectors_file = args[i+1]
+	}
+	if i := ArgPos("-init-binary", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		init_binary = int(v)
+	}
+	if i := ArgPos("-init-lock", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		init_lock = int(v)
+	}
+	if i := ArgPos("-adagrad", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		adagrad = int(v)
+	}
 	if i := ArgPos("-debug", args); i > 0 {
 		v, _ := strconv.ParseInt(args[i+1], 10, 64)
 		debug_mode = int(v)
@@ -956,6 +1212,31 @@ func main() {
 		v, _ := strconv.ParseInt(args[i+1], 10, 64)
 		binaryf = int(v)
 	}
+	if i := ArgPos("-output-format", args); i > 0 {
+		output_format = args[i+1]
+		switch output_format {
+		case "word2vec", "glove", "tensorboard", "npy":
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown output format %s\n", output_format)
+			os.Exit(1)
+		}
+	}
+	if i := ArgPos("-output-meta", args); i > 0 {
+		output_meta_file = args[i+1]
+	}
+	if i := ArgPos("-save-context", args); i > 0 {
+		save_context_file = args[i+1]
+	}
+	if i := ArgPos("-combine", args); i > 0 {
+		combine = args[i+1]
+		if combine != "none" && combine != "sum" && combine != "avg" {
+			fmt.Fprintf(os.Stderr, "Unknown -combine mode %s\n", combine)
+			os.Exit(1)
+		}
+	}
+	if i := ArgPos("-save-model", args); i > 0 {
+		save_model_file = args[i+1]
+	}
 	if i := ArgPos("-cbow", args); i > 0 {
 		v, _ := strconv.ParseInt(args[i+1], 10, 64)
 		cbow = int(v)
@@ -963,10 +1244,41 @@ func main() {
 	if cbow != 0 {
 		alpha = 0.05
 	}
+	if i := ArgPos("-structured", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		structured = int(v)
+	}
 	if i := ArgPos("-alpha", args); i > 0 {
 		v, _ := strconv.ParseFloat(args[i+1], 64)
 		alpha = float64(v)
 	}
+	if i := ArgPos("-min-alpha", args); i > 0 {
+		v, _ := strconv.ParseFloat(args[i+1], 64)
+		min_alpha = float64(v)
+	}
+	if i := ArgPos("-lr-schedule", args); i > 0 {
+		lr_schedule = args[i+1]
+	}
+	if !lr_schedules[lr_schedule] {
+		fmt.Fprintf(os.Stderr, "ERROR: unknown learning rate schedule %s\n", lr_schedule)
+		os.Exit(1)
+	}
+	if i := ArgPos("-lr-warmup", args); i > 0 {
+		v, _ := strconv.ParseFloat(args[i+1], 64)
+		lr_warmup = float64(v)
+	}
+	if i := ArgPos("-lr-step-size", args); i > 0 {
+		v, _ := strconv.ParseFloat(args[i+1], 64)
+		lr_step_size = float64(v)
+	}
+	if i := ArgPos("-lr-step-decay", args); i > 0 {
+		v, _ := strconv.ParseFloat(args[i+1], 64)
+		lr_step_decay = float64(v)
+	}
+	if lr_warmup <= 0 || lr_warmup >= 1 || lr_step_size <= 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: -lr-warmup must be between 0 and 1 and -lr-step-size must be positive\n")
+		os.Exit(1)
+	}
 	if i := ArgPos("-output", args); i > 0 {
 		output_file = args[i+1]
 	}
@@ -974,6 +1286,49 @@ func main() {
 		v, _ := strconv.ParseInt(args[i+1], 10, 64)
 		window = int(v)
 	}
+	if i := ArgPos("-window-left", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		window_left = int(v)
+	}
+	if i := ArgPos("-window-right", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		window_right = int(v)
+	}
+	if window_left < 0 {
+		window_left = window
+	}
+	if window_right < 0 {
+		window_right = window
+	}
+	window = window_left
+	if window_right > window {
+		window = window_right
+	}
+	if window < 1 {
+		fmt.Fprintf(os.Stderr, "ERROR: the window must contain at least one word\n")
+		os.Exit(1)
+	}
+	if i := ArgPos("-window-mode", args); i > 0 {
+		window_mode = args[i+1]
+		switch window_mode {
+		case "dynamic", "fixed", "harmonic", "linear":
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown window mode %s\n", window_mode)
+			os.Exit(1)
+		}
+	}
+	if i := ArgPos("-max-sequence", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		max_sentence_length = int(v)
+		if max_sentence_length < 1 {
+			fmt.Fprintf(os.Stderr, "ERROR: -max-sequence must be positive\n")
+			os.Exit(1)
+		}
+	}
+	if i := ArgPos("-doc-separator", args); i > 0 {
+		doc_mode = true
+		doc_separator = args[i+1]
+	}
 	if i := ArgPos("-sample", args); i > 0 {
 		v, _ := strconv.ParseFloat(args[i+1], 64)
 		sample = float64(v)
@@ -987,10 +1342,52 @@ func main() {
 		negative = int(v)
 	}
 	fmt.Fprintf(os.Stderr, "negative: %d\n", negative)
+	if i := ArgPos("-ns-power", args); i > 0 {
+		ns_power, _ = strconv.ParseFloat(args[i+1], 64)
+	}
+	if i := ArgPos("-ns-dist", args); i > 0 {
+		ns_dist_file = args[i+1]
+	}
+	if negative == 0 && (save_context_file != "" || combine != "none") {
+		fmt.Fprintf(os.Stderr, "ERROR: -save-context and -combine need the negative sampling weights (-negative > 0)\n")
+		os.Exit(1)
+	}
+	if train_pairs_file != "" && (hs != 0 || negative == 0 || structured != 0 || combine != "none" || read_vocab_file != "" || save_model_file != "") {
+		fmt.Fprintf(os.Stderr, "ERROR: -train-pairs supports only negative sampling without -hs, -structured, -combine, -read-vocab and -save-model\n")
+		os.Exit(1)
+	}
+	if structured != 0 && (save_context_file != "" || combine != "none") {
+		fmt.Fprintf(os.Stderr, "ERROR: -save-context and -combine cannot be used with -structured\n")
+		os.Exit(1)
+	}
 	if i := ArgPos("-threads", args); i > 0 {
 		v, _ := strconv.ParseInt(args[i+1], 10, 64)
 		num_threads = int(v)
 	}
+	if i := ArgPos("-workers", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		workers = int(v)
+	}
+	// TrainPairsThread reads the whole pairs file, it cannot train a shard
+	if workers > 0 && train_pairs_file != "" {
+		fmt.Fprintf(os.Stderr, "ERROR: -workers cannot be used with -train-pairs\n")
+		os.Exit(1)
+	}
+	if i := ArgPos("-sync-per-iter", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		sync_per_iter = int(v)
+		if sync_per_iter < 1 {
+			fmt.Fprintf(os.Stderr, "ERROR: -sync-per-iter must be positive\n")
+			os.Exit(1)
+		}
+	}
+	if i := ArgPos("-worker-id", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		worker_id = int(v)
+	}
+	if i := ArgPos("-worker-socket", args); i > 0 {
+		worker_socket = args[i+1]
+	}
 	if i := ArgPos("-iter", args); i > 0 {
 		v, _ := strconv.ParseInt(args[i+1], 10, 64)
 		iter = int(v)
@@ -999,12 +1396,39 @@ func main() {
 		v, _ := strconv.ParseInt(args[i+1], 10, 64)
 		min_count = int(v)
 	}
+	if i := ArgPos("-max-vocab", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		max_vocab = int(v)
+	}
+	if i := ArgPos("-vocab-mem", args); i > 0 {
+		vocab_mem_mb, _ = strconv.ParseInt(args[i+1], 10, 64)
+	}
 	if i := ArgPos("-classes", args); i > 0 {
 		v, _ := strconv.ParseInt(args[i+1], 10, 64)
 		classes = int(v)
 	}
+	if i := ArgPos("-classes-iter", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		classes_iter = int(v)
+	}
+	if i := ArgPos("-classes-tol", args); i > 0 {
+		classes_tol, _ = strconv.ParseFloat(args[i+1], 64)
+	}
+	if i := ArgPos("-classes-dist", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		classes_dist = int(v)
+	}
+	if i := ArgPos("-save-centroids", args); i > 0 {
+		save_centroids_file = args[i+1]
+	}
+	if i := ArgPos("-save-class-sizes", args); i > 0 {
+		save_class_sizes_file = args[i+1]
+	}
+	if i := ArgPos("-hclusters", args); i > 0 {
+		v, _ := strconv.ParseInt(args[i+1], 10, 64)
+		hclusters = int(v)
+	}
 	vocab = make([]vocab_word, vocab_max_size)
-	vocab_hash = make([]int, vocab_hash_size)
 	expTable = make([]float64, EXP_TABLE_SIZE+1)
 	for i = 0; i < EXP_TABLE_SIZE; i++ {
 		expTable[i] = math.Exp((float64(i)/float64(EXP_TABLE_SIZE)*2 - 1) * MAX_EXP) // Precompute the exp() table
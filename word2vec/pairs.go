@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+var train_pairs_file string
+var context_min_count int = -1
+var context_vocab vocab_slice
+var context_size int = 0
+var context_index map[string]int
+
+// Reads the next 'word context' line; ok is false for malformed lines
+func ReadPair(br *bufio.Reader) (word, context string, ok bool, err error) {
+	line, err := br.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	st := strings.Fields(line)
+	if len(st) != 2 {
+		return
+	}
+	return st[0], st[1], true, nil
+}
+
+// Counts, sorts and prunes a vocabulary collected in a map, most frequent first
+func SortPairVocab(counts map[string]int, min int) (vocab_slice, int64) {
+	var v vocab_slice
+	var dropped int64 = 0
+	for w, cn := range counts {
+		if cn < min {
+			dropped += int64(cn)
+			continue
+		}
+		v = append(v, vocab_word{cn: cn, word: w})
+	}
+	sort.Sort(v)
+	return v, dropped
+}
+
+// Builds separate word and context vocabularies from the pairs file
+func LearnPairVocab() {
+	fmt.Fprintln(os.Stderr, "LearnPairVocab")
+	var malformed int64 = 0
+	f, err := os.Open(train_pairs_file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: training pairs file not found!\n")
+		os.Exit(1)
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	wcn := make(map[string]int)
+	ccn := make(map[string]int)
+	for {
+		word, context, ok, err := ReadPair(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot read %s: %v\n", train_pairs_file, err)
+			os.Exit(1)
+		}
+		if !ok {
+			malformed++
+			continue
+		}
+		train_words++
+		if (debug_mode > 1) && (train_words%100000 == 0) {
+			fmt.Fprintf(os.Stderr, "%dK%c", train_words/1000, 13)
+		}
+		wcn[word]++
+		ccn[context]++
+	}
+	if context_min_count < 0 {
+		context_min_count = min_count
+	}
+	var wdropped, cdropped int64
+	vocab, wdropped = SortPairVocab(wcn, min_count)
+	context_vocab, cdropped = SortPairVocab(ccn, context_min_count)
+	vocab_size = len(vocab)
+	vocab_max_size = vocab_size
+	context_size = len(context_vocab)
+	if vocab_size == 0 || context_size == 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: no words or contexts left after applying the min-counts\n")
+		os.Exit(1)
+	}
+	RehashVocab()
+	context_index = make(map[string]int, context_size)
+	for a := 0; a < context_size; a++ {
+		context_index[context_vocab[a].word] = a
+	}
+	// Allocate memory for the binary tree construction
+	for a := 0; a < vocab_size; a++ {
+		vocab[a].code = make([]byte, MAX_CODE_LENGTH)
+		vocab[a].point = make([]int, MAX_CODE_LENGTH)
+	}
+	if debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "Word vocab size: %d\n", vocab_size)
+		fmt.Fprintf(os.Stderr, "Context vocab size: %d\n", context_size)
+		fmt.Fprintf(os.Stderr, "Pairs in train file: %d\n", train_words)
+		fmt.Fprintf(os.Stderr, "Dropped by min-count: %d word tokens, %d context tokens\n", wdropped, cdropped)
+		if malformed > 0 {
+			fmt.Fprintf(os.Stderr, "Skipped %d malformed lines\n", malformed)
+		}
+	}
+	fi, _ := os.Stat(train_pairs_file)
+	file_size = fi.Size()
+}
+
+// Returns position of a context in the context vocabulary; if it is not found, returns -1
+func SearchContext(context string) int {
+	if i, ok := context_index[context]; ok {
+		return i
+	}
+	return -1
+}
+
+// Builds the negative sampling distribution over the contexts
+func InitContextSampler() {
+	fmt.Fprintln(os.Stderr, "InitContextSampler")
+	weights := make([]float64, context_size)
+	if ns_dist_file != "" {
+		ReadNegativeDistribution(ns_dist_file, weights, SearchContext)
+	} else {
+		for a := 0; a < context_size; a++ {
+			weights[a] = math.Pow(float64(context_vocab[a].cn), ns_power)
+		}
+	}
+	var sum float64 = 0
+	for a := 0; a < context_size; a++ {
+		sum += weights[a]
+	}
+	if sum == 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: the negative sampling distribution is empty\n")
+		os.Exit(1)
+	}
+	sampler = NewAliasSampler(weights)
+}
+
+// Trains skip-gram with negative sampling over the (word, context) pairs of a part of the pairs file
+func TrainPairsThread(id int) {
+	var word, context, target, label, l1, l2 int
+	var word_count, last_word_count int64 = 0, 0
+	var local_iter int = iter
+	var next_random uint64 = uint64(id)
+	var thread_alpha float64 = UpdateAlpha()
+	var f, g float64
+	var neu1e []float64 = make([]float64, layer1_size)
+	fi, _ := os.Open(train_pairs_file)
+	defer fi.Close()
+	var br *bufio.Reader
+	// Starts reading at the first full line of this thread's part of the file
+	rewind := func() {
+		fi.Seek(file_size/int64(num_threads)*int64(id), SEEK_SET)
+		br = bufio.NewReader(fi)
+		if id > 0 {
+			br.ReadString('\n')
+		}
+	}
+	rewind()
+	for {
+		if word_count-last_word_count > 10000 {
+			atomic.AddInt64(&word_count_actual, word_count-last_word_count)
+			last_word_count = word_count
+			thread_alpha = UpdateAlpha()
+			if debug_mode > 1 {
+				ReportProgress("Pairs")
+			}
+		}
+		if Stopping() {
+			atomic.AddInt64(&word_count_actual, word_count-last_word_count)
+			StopEarly()
+			break
+		}
+		w, c, ok, err := ReadPair(br)
+		if err != nil || (word_count > train_words/int64(num_threads)) {
+			atomic.AddInt64(&word_count_actual, word_count-last_word_count)
+			local_iter--
+			if local_iter == 0 {
+				break
+			}
+			word_count = 0
+			last_word_count = 0
+			rewind()
+			continue
+		}
+		if !ok {
+			continue
+		}
+		word_count++
+		word = SearchVocab(w)
+		context = SearchContext(c)
+		if word == -1 || context == -1 {
+			continue
+		}
+		l1 = word * layer1_size
+		for a := 0; a < layer1_size; a++ {
+			neu1e[a] = 0
+		}
+		for d := 0; d < negative+1; d++ {
+			if d == 0 {
+				target = context
+				label = 1
+			} else {
+				target = sampler.Sample(&next_random)
+				if target == context {
+					continue
+				}
+				label = 0
+			}
+			l2 = target * layer1_size
+			f = 0
+			for a := 0; a < layer1_size; a++ {
+				f += syn0[a+l1] * syn1neg[a+l2]
+			}
+			if f > MAX_EXP {
+				g = float64(label-1) * thread_alpha
+			} else if f < -MAX_EXP {
+				g = float64(label-0) * thread_alpha
+			} else {
+				g = (float64(label) - expTable[(int)((f+MAX_EXP)*(float64(EXP_TABLE_SIZE)/MAX_EXP/2))]) * thread_alpha
+			}
+			for a := 0; a < layer1_size; a++ {
+				neu1e[a] += g * syn1neg[a+l2]
+			}
+			if adagrad != 0 {
+				for a := 0; a < layer1_size; a++ {
+					syn1neg[a+l2] += AdaGradStep(&syn1neg_g2[a+l2], g*syn0[a+l1], thread_alpha)
+				}
+			} else {
+				for a := 0; a < layer1_size; a++ {
+					syn1neg[a+l2] += g * syn0[a+l1]
+				}
+			}
+		}
+		if Trainable(word) {
+			if adagrad != 0 {
+				for a := 0; a < layer1_size; a++ {
+					syn0[a+l1] += AdaGradStep(&syn0_g2[a+l1], neu1e[a], thread_alpha)
+				}
+			} else {
+				for a := 0; a < layer1_size; a++ {
+					syn0[a+l1] += neu1e[a]
+				}
+			}
+		}
+	}
+}
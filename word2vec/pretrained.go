@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var init_vectors_file string
+var init_binary int = 0
+var init_lock int = 0
+var syn0_lock []bool
+
+// Copies the vectors of an existing model into syn0 for the words that are also in the vocabulary
+func LoadInitVectors() {
+	fmt.Fprintln(os.Stderr, "LoadInitVectors")
+	var words, size, found int
+	f, err := os.Open(init_vectors_file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: initial vectors file %s not found!\n", init_vectors_file)
+		os.Exit(1)
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	if _, err := fmt.Fscanf(br, "%d %d", &words, &size); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot read the header of %s\n", init_vectors_file)
+		os.Exit(1)
+	}
+	if size != layer1_size {
+		fmt.Fprintf(os.Stderr, "ERROR: %s has vectors of size %d, but -size is %d\n", init_vectors_file, size, layer1_size)
+		os.Exit(1)
+	}
+	if init_lock != 0 {
+		syn0_lock = make([]bool, vocab_size)
+	}
+	vec := make([]float64, size)
+	for b := 0; b < words; b++ {
+		var word string
+		if init_binary != 0 {
+			word, err = br.ReadString(' ')
+			if err == nil {
+				err = binary.Read(br, binary.LittleEndian, vec)
+			}
+		} else {
+			var line string
+			line, err = br.ReadString('\n')
+			if err == io.EOF && line != "" {
+				err = nil
+			}
+			st := strings.Fields(line)
+			if err == nil && len(st) == 0 {
+				b--
+				continue
+			}
+			if err == nil && len(st) != size+1 {
+				err = fmt.Errorf("expected %d values, got %d", size, len(st)-1)
+			}
+			for a := 0; err == nil && a < size; a++ {
+				vec[a], err = strconv.ParseFloat(st[a+1], 64)
+			}
+			if len(st) > 0 {
+				word = st[0]
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: cannot read vector %d of %s: %v\n", b+1, init_vectors_file, err)
+			os.Exit(1)
+		}
+		i := SearchVocab(strings.TrimSpace(word))
+		if i == -1 {
+			continue
+		}
+		copy(syn0[i*layer1_size:(i+1)*layer1_size], vec)
+		if syn0_lock != nil {
+			syn0_lock[i] = true
+		}
+		found++
+	}
+	if debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "Initialized %d of %d words from %s\n", found, vocab_size, init_vectors_file)
+	}
+}
+
+// Reports whether the syn0 row of word may be updated
+func Trainable(word int) bool {
+	return syn0_lock == nil || !syn0_lock[word]
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Samples indices from a discrete distribution in constant time with Walker's alias method;
+// memory is linear in the number of outcomes
+type alias_sampler struct {
+	prob  []float64
+	alias []int
+}
+
+var ns_power float64 = 0.75
+var ns_dist_file string
+var sampler *alias_sampler
+
+// Builds an alias sampler for outcomes drawn proportionally to weights (Vose's construction)
+func NewAliasSampler(weights []float64) *alias_sampler {
+	n := len(weights)
+	s := &alias_sampler{make([]float64, n), make([]int, n)}
+	var sum float64 = 0
+	for _, w := range weights {
+		sum += w
+	}
+	small := make([]int, 0, n)
+	large := make([]int, 0, n)
+	for a := 0; a < n; a++ {
+		s.prob[a] = weights[a] * float64(n) / sum
+		s.alias[a] = a
+		if s.prob[a] < 1 {
+			small = append(small, a)
+		} else {
+			large = append(large, a)
+		}
+	}
+	for len(small) > 0 && len(large) > 0 {
+		l := small[len(small)-1]
+		small = small[:len(small)-1]
+		g := large[len(large)-1]
+		s.alias[l] = g
+		s.prob[g] -= 1 - s.prob[l]
+		if s.prob[g] < 1 {
+			large = large[:len(large)-1]
+			small = append(small, g)
+		}
+	}
+	// Whatever is left is 1 up to rounding errors
+	for _, a := range large {
+		s.prob[a] = 1
+	}
+	for _, a := range small {
+		s.prob[a] = 1
+	}
+	return s
+}
+
+// Draws an index, advancing the caller's random state
+func (s *alias_sampler) Sample(next_random *uint64) int {
+	*next_random = *next_random*uint64(25214903917) + 11
+	a := int((*next_random >> 16) % uint64(len(s.prob)))
+	*next_random = *next_random*uint64(25214903917) + 11
+	if float64((*next_random>>16)&0xFFFFFF)/float64(0x1000000) < s.prob[a] {
+		return a
+	}
+	return s.alias[a]
+}
+
+// Reads 'word weight' lines giving a custom negative sampling distribution; words missing from the file are never sampled
+func ReadNegativeDistribution(file string, weights []float64, lookup func(string) int) {
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: negative sampling distribution file %s not found!\n", file)
+		os.Exit(1)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		st := strings.Fields(scanner.Text())
+		if len(st) == 0 {
+			continue
+		}
+		if len(st) != 2 {
+			fmt.Fprintf(os.Stderr, "ERROR: %s:%d: expected 'word weight'\n", file, line)
+			os.Exit(1)
+		}
+		w, err := strconv.ParseFloat(st[1], 64)
+		if err != nil || w < 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+			fmt.Fprintf(os.Stderr, "ERROR: %s:%d: invalid weight %s\n", file, line, st[1])
+			os.Exit(1)
+		}
+		if i := lookup(st[0]); i != -1 {
+			weights[i] = w
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot read %s: %v\n", file, err)
+		os.Exit(1)
+	}
+}
+
+// Builds the negative sampling distribution, either unigram counts raised to ns_power or the weights of ns_dist_file;
+// </s> is never drawn as a negative example
+func InitUnigramTable() {
+	fmt.Fprintln(os.Stderr, "InitUnigramTable")
+	weights := make([]float64, vocab_size)
+	if ns_dist_file != "" {
+		ReadNegativeDistribution(ns_dist_file, weights, SearchVocab)
+	} else {
+		for a := 0; a < vocab_size; a++ {
+			weights[a] = math.Pow(float64(vocab[a].cn), ns_power)
+		}
+	}
+	weights[0] = 0
+	var sum float64 = 0
+	for a := 0; a < vocab_size; a++ {
+		sum += weights[a]
+	}
+	if sum == 0 {
+		fmt.Fprintf(os.Stderr, "ERROR: the negative sampling distribution is empty\n")
+		os.Exit(1)
+	}
+	sampler = NewAliasSampler(weights)
+}
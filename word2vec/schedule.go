@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+var lr_schedule string = "linear"
+var min_alpha float64 = -1 // Negative means starting_alpha * 0.0001
+var lr_warmup float64 = 0.05
+var lr_step_size float64 = 0.25
+var lr_step_decay float64 = 0.5
+var current_alpha uint64 // Bits of the learning rate last computed by a training thread
+
+var lr_schedules = map[string]bool{"linear": true, "cosine": true, "constant": true, "step": true, "warmup-linear": true}
+
+// Returns the learning rate after the fraction progress of the training has been done
+func ScheduledAlpha(progress float64) float64 {
+	if progress > 1 {
+		progress = 1
+	}
+	var a float64
+	switch lr_schedule {
+	case "constant":
+		return starting_alpha
+	case "cosine":
+		a = min_alpha + (starting_alpha-min_alpha)*0.5*(1+math.Cos(math.Pi*progress))
+	case "step":
+		a = starting_alpha * math.Pow(lr_step_decay, math.Floor(progress/lr_step_size))
+	case "warmup-linear":
+		if progress < lr_warmup {
+			// Rise from min_alpha to starting_alpha, then decay linearly for the rest of the training
+			a = min_alpha + (starting_alpha-min_alpha)*progress/lr_warmup
+		} else {
+			a = starting_alpha * (1 - (progress-lr_warmup)/(1-lr_warmup))
+		}
+	default:
+		a = starting_alpha * (1 - progress)
+	}
+	if a < min_alpha {
+		a = min_alpha
+	}
+	return a
+}
+
+// Returns the fraction of the training done so far by all threads
+func TrainingProgress() float64 {
+	return float64(atomic.LoadInt64(&word_count_actual)) / float64(total_words+1)
+}
+
+// Returns the learning rate for the global training progress; every thread keeps its own copy, and the
+// last rate computed is stored atomically for ReportProgress
+func UpdateAlpha() float64 {
+	a := ScheduledAlpha(TrainingProgress())
+	atomic.StoreUint64(&current_alpha, math.Float64bits(a))
+	return a
+}
+
+// Prints the schedule, the learning rate and the training progress; unit names what is counted
+func ReportProgress(unit string) {
+	now := time.Now()
+	fmt.Fprintf(os.Stderr, "%cSchedule: %s  Alpha: %f  Progress: %.2f%%  %s/thread/sec: %.2fk  ", 13, lr_schedule,
+		math.Float64frombits(atomic.LoadUint64(&current_alpha)), TrainingProgress()*100,
+		unit, float64(atomic.LoadInt64(&word_count_actual))/(float64(now.Unix()-start.Unix()+1)*1000))
+}
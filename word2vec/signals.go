@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+var stop_training int32 = 0
+var stop_requested = make(chan struct{}) // Closed on the first interrupt
+var stopped_early int32 = 0              // Set when a training thread leaves words of its part untrained
+
+// Records that a training thread stopped for an interrupt before the end of its part
+func StopEarly() {
+	atomic.StoreInt32(&stopped_early, 1)
+}
+
+// Returns whether a training thread stopped before the end of its part, so that the vectors are partial;
+// an interrupt that comes after the threads finished does not make them partial
+func StoppedEarly() bool {
+	return atomic.LoadInt32(&stopped_early) != 0
+}
+
+// Returns whether an interrupt asked the training threads to stop
+func Stopping() bool {
+	return atomic.LoadInt32(&stop_training) != 0
+}
+
+// Returns the name under which an interrupted training saves file
+func PartialFileName(file string) string {
+	return file + ".partial"
+}
+
+// Returns the name under which SIGUSR1 snapshots file
+func SnapshotFileName(file string) string {
+	return file + ".snapshot"
+}
+
+// Makes SIGINT and SIGTERM stop the training threads between sentences, a second one exits at once,
+// and makes SIGUSR1 save a snapshot of the word vectors while the training goes on
+func HandleSignals() {
+	ch := make(chan os.Signal, 4)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
+	go func() {
+		for sig := range ch {
+			if sig == syscall.SIGUSR1 {
+				SaveSnapshot()
+				continue
+			}
+			if !atomic.CompareAndSwapInt32(&stop_training, 0, 1) {
+				fmt.Fprintf(os.Stderr, "\nInterrupted again, exiting without saving\n")
+				os.Exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "\nInterrupted, stopping the training and saving the partial vectors; interrupt again to exit at once\n")
+			close(stop_requested)
+		}
+	}()
+}
+
+// Saves the current word vectors next to the output file; the training threads keep updating them meanwhile
+func SaveSnapshot() {
+	file := SnapshotFileName(output_file)
+	fmt.Fprintf(os.Stderr, "\nSaving a snapshot at %.2f%% progress to %s\n", TrainingProgress()*100, file)
+	SaveVectors(file, OutputVectors())
+}
+
+// Saves the word vectors of an interrupted training, and the vocabulary if requested, marked as partial
+func SavePartial() {
+	file := PartialFileName(output_file)
+	fmt.Fprintf(os.Stderr, "Training stopped at %.2f%% progress, saving the partial vectors to %s\n", TrainingProgress()*100, file)
+	SaveVectors(file, OutputVectors())
+	if save_vocab_file != "" {
+		SaveVocabFile(PartialFileName(save_vocab_file), vocab_format)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var vocab_format string = "text"
+var read_vocab_format string = "auto"
+var vocab_columns []string
+
+var vocab_formats = map[string]bool{"text": true, "tsv": true, "json": true}
+var vocab_column_names = map[string]bool{"rank": true, "freq": true, "cumfreq": true}
+
+// Exits with the position of a malformed vocabulary entry
+func VocabError(file string, line int, format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "ERROR: %s:%d: %s\n", file, line, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Adds cn occurrences of word read at line of file to the vocabulary; seen holds the words of file so far
+func AddVocabEntry(file string, line int, word string, cn int64, seen map[string]int) {
+	if word == "" {
+		VocabError(file, line, "empty word")
+	}
+	if len(word) >= MAX_STRING {
+		VocabError(file, line, "word longer than %d bytes", MAX_STRING-1)
+	}
+	if strings.ContainsAny(word, " \t\n\r") {
+		VocabError(file, line, "word %q contains white space", word)
+	}
+	if cn < 0 {
+		VocabError(file, line, "negative count %d for word %q", cn, word)
+	}
+	if prev, ok := seen[word]; ok {
+		VocabError(file, line, "word %q already listed at line %d", word, prev)
+	}
+	seen[word] = line
+	a := SearchVocab(word)
+	if a == -1 {
+		a = AddWordToVocab(word)
+	}
+	vocab[a].cn += int(cn)
+}
+
+// Parses the count field of a text or TSV vocabulary line
+func ParseCount(file string, line int, field string) int64 {
+	cn, err := strconv.ParseInt(field, 10, 64)
+	if err != nil {
+		VocabError(file, line, "invalid count %q", field)
+	}
+	return cn
+}
+
+// Returns the format of the vocabulary file to read: read_vocab_format, or with auto the format given
+// by the extension of file, .tsv or .json, and text otherwise
+func VocabFileFormat(file string) string {
+	if read_vocab_format != "auto" {
+		return read_vocab_format
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".tsv":
+		return "tsv"
+	case ".json":
+		return "json"
+	}
+	return "text"
+}
+
+// Reads a vocabulary file in format and adds its counts to the vocabulary
+func ReadVocabFile(file, format string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: vocabulary file %s not found\n", file)
+		os.Exit(1)
+	}
+	seen := make(map[string]int)
+	if format == "json" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		// Counts the lines up to the decoder position from where the previous call stopped
+		var counted int64 = 0
+		current := 1
+		lineOf := func() int {
+			off := dec.InputOffset()
+			current += bytes.Count(data[counted:off], []byte("\n"))
+			counted = off
+			return current
+		}
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			VocabError(file, lineOf(), "expected a JSON array of {\"word\": ..., \"count\": ...} objects")
+		}
+		for dec.More() {
+			// Skip the white space before the entry so that its own line is reported
+			line := lineOf()
+			for off := dec.InputOffset(); off < int64(len(data)) && strings.ContainsRune(" \t\r\n,", rune(data[off])); off++ {
+				if data[off] == '\n' {
+					line++
+				}
+			}
+			var entry struct {
+				Word  *string `json:"word"`
+				Count *int64  `json:"count"`
+			}
+			if err := dec.Decode(&entry); err != nil {
+				VocabError(file, line, "%v", err)
+			}
+			if entry.Word == nil || entry.Count == nil {
+				VocabError(file, line, "entry without word or count")
+			}
+			AddVocabEntry(file, line, *entry.Word, *entry.Count, seen)
+		}
+		if _, err := dec.Token(); err != nil {
+			VocabError(file, lineOf(), "%v", err)
+		}
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	columns := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if format == "tsv" {
+			st := strings.Split(text, "\t")
+			if line == 1 {
+				if len(st) < 2 || st[0] != "word" || st[1] != "count" {
+					VocabError(file, line, "expected a header starting with word<TAB>count")
+				}
+				columns = len(st)
+				continue
+			}
+			if text == "" {
+				continue
+			}
+			if len(st) != columns {
+				VocabError(file, line, "%d columns, the header has %d", len(st), columns)
+			}
+			AddVocabEntry(file, line, st[0], ParseCount(file, line, st[1]), seen)
+			continue
+		}
+		st := strings.Fields(text)
+		if len(st) == 0 {
+			continue
+		}
+		if len(st) != 2 {
+			VocabError(file, line, "expected a word and its count, found %d fields", len(st))
+		}
+		AddVocabEntry(file, line, st[0], ParseCount(file, line, st[1]), seen)
+	}
+	if err := scanner.Err(); err != nil {
+		VocabError(file, line+1, "%v", err)
+	}
+}
+
+// Reads the vocabulary from the comma separated files of read_vocab_file, summing the counts of words listed
+// in several of them; each file may have its own format
+func ReadVocab() {
+	fmt.Fprintln(os.Stderr, "ReadVocab")
+	InitVocabHash(0)
+	vocab_size = 0
+	// </s> keeps the first position even if the files do not list it
+	AddWordToVocab("</s>")
+	for _, file := range strings.Split(read_vocab_file, ",") {
+		ReadVocabFile(file, VocabFileFormat(file))
+	}
+	if output_file == "" {
+		// Only merging: every word is kept, the cut-offs are for the vocabulary of a training
+		min_count, max_vocab = 0, 0
+	}
+	SortVocab()
+	if debug_mode > 0 {
+		fmt.Fprintf(os.Stderr, "Vocab size: %d\n", vocab_size)
+		fmt.Fprintf(os.Stderr, "Words in train file: %d\n", train_words)
+		ReportVocabDrops()
+	}
+	if output_file == "" {
+		return
+	}
+	fi, err := os.Stat(train_file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: training data file not found!\n")
+		os.Exit(1)
+	}
+	file_size = fi.Size()
+}
+
+// Returns s as a JSON string; unlike json.Marshal, < > and & are written as they are
+func JSONString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// Saves the vocabulary to save_vocab_file in vocab_format
+func SaveVocab() {
+	SaveVocabFile(save_vocab_file, vocab_format)
+}
+
+// Saves the vocabulary to file in format, with the extra vocab_columns in the TSV and JSON formats
+func SaveVocabFile(file, format string) {
+	fmt.Fprintln(os.Stderr, "SaveVocab")
+	f, fo := CreateOutput(file)
+	defer f.Close()
+	var cum int64 = 0
+	// Returns the value of the extra column name for word a
+	column := func(name string, a int) string {
+		switch name {
+		case "rank":
+			return strconv.Itoa(a)
+		case "freq":
+			return strconv.FormatFloat(float64(vocab[a].cn)/float64(train_words), 'g', 6, 64)
+		default:
+			return strconv.FormatFloat(float64(cum)/float64(train_words), 'g', 6, 64)
+		}
+	}
+	switch format {
+	case "tsv":
+		fmt.Fprintf(fo, "word\tcount")
+		for _, name := range vocab_columns {
+			fmt.Fprintf(fo, "\t%s", name)
+		}
+		fmt.Fprintf(fo, "\n")
+		for a := 0; a < vocab_size; a++ {
+			cum += int64(vocab[a].cn)
+			fmt.Fprintf(fo, "%s\t%d", vocab[a].word, vocab[a].cn)
+			for _, name := range vocab_columns {
+				fmt.Fprintf(fo, "\t%s", column(name, a))
+			}
+			fmt.Fprintf(fo, "\n")
+		}
+	case "json":
+		fmt.Fprintf(fo, "[\n")
+		for a := 0; a < vocab_size; a++ {
+			cum += int64(vocab[a].cn)
+			fmt.Fprintf(fo, "  {\"word\": %s, \"count\": %d", JSONString(vocab[a].word), vocab[a].cn)
+			for _, name := range vocab_columns {
+				fmt.Fprintf(fo, ", \"%s\": %s", name, column(name, a))
+			}
+			if a < vocab_size-1 {
+				fmt.Fprintf(fo, "},\n")
+			} else {
+				fmt.Fprintf(fo, "}\n")
+			}
+		}
+		fmt.Fprintf(fo, "]\n")
+	default:
+		for a := 0; a < vocab_size; a++ {
+			fmt.Fprintf(fo, "%s %d\n", vocab[a].word, vocab[a].cn)
+		}
+	}
+	if err := fo.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: cannot write %s: %v\n", file, err)
+		os.Exit(1)
+	}
+}